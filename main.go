@@ -27,10 +27,33 @@ var (
 	metricsListenAddr = kingpin.Flag("metrics-listen-address", "The address this plugin provides metrics on").Default(":8889").Envar("METRICS_LISTEN_ADDRESS").String()
 	tlsConfig         = kingpin.Flag("tls-config", "Path to TLS config file.").Envar("TLS_CONFIG").Default("").String()
 
-	domainFilter = kingpin.Flag("domain-filter", "Limit possible target zones by a domain suffix; specify multiple times for multiple domains").Required().Envar("DOMAIN_FILTER").Strings()
-	dryRun       = kingpin.Flag("dry-run", "Run without connecting to Porkbun's API").Default("false").Envar("DRY_RUN").Bool()
-	apiKey       = kingpin.Flag("api-key", "The api key to connect to Porkbun's API").Required().Envar("API_KEY").String()
-	apiSecret    = kingpin.Flag("api-secret", "The api password to connect to Porkbun's API").Required().Envar("API_SECRET").String()
+	domainFilter          = kingpin.Flag("domain-filter", "Limit possible target zones by a domain suffix; specify multiple times for multiple domains").Envar("DOMAIN_FILTER").Strings()
+	excludeDomains        = kingpin.Flag("exclude-domains", "Exclude subdomains; specify multiple times for multiple domains").Envar("EXCLUDE_DOMAINS").Strings()
+	regexDomainFilter     = kingpin.Flag("regex-domain-filter", "Limit possible domains by a regular expression; takes precedence over domain-filter and exclude-domains when matching").Envar("REGEX_DOMAIN_FILTER").Regexp()
+	regexDomainExclusion  = kingpin.Flag("regex-domain-exclusion", "Exclude domains matching this regular expression; takes precedence over regex-domain-filter").Envar("REGEX_DOMAIN_EXCLUSION").Regexp()
+	dryRun                = kingpin.Flag("dry-run", "Run without connecting to Porkbun's API").Default("false").Envar("DRY_RUN").Bool()
+	apiKey                = kingpin.Flag("api-key", "The api key to connect to Porkbun's API").Required().Envar("API_KEY").String()
+	apiSecret             = kingpin.Flag("api-secret", "The api password to connect to Porkbun's API").Required().Envar("API_SECRET").String()
+	zoneDiscovery         = kingpin.Flag("zone-discovery", "Discover the zones from the domains in the Porkbun account; the domain filter then narrows the discovered zones").Default("false").Envar("ZONE_DISCOVERY").Bool()
+	zoneDiscoveryInterval = kingpin.Flag("zone-discovery-interval", "How often the domains in the Porkbun account are listed again when zone discovery is enabled").Default("1h").Envar("ZONE_DISCOVERY_INTERVAL").Duration()
+	zoneConfig            = kingpin.Flag("zone-config", "Path to an optional YAML or JSON file with per-zone settings").Default("").Envar("ZONE_CONFIG").String()
+	protectedRecords      = kingpin.Flag("protected-record", "Never change records matching '<name pattern> [<type>]', e.g. '@ MX' or '_dmarc TXT'; specify multiple times for multiple rules").Envar("PROTECTED_RECORDS").Strings()
+	managedRecordTypes    = kingpin.Flag("managed-record-types", "Record types to report and change, records of other types are left alone; specify multiple times for multiple types (default: all supported types)").Envar("MANAGED_RECORD_TYPES").Strings()
+	applyOrder            = kingpin.Flag("apply-order", "Order of the record changes in a zone: delete-first, or create-first to create records before deleting the records they replace").Default(string(porkbun.ApplyOrderDeleteFirst)).Envar("APPLY_ORDER").Enum(string(porkbun.ApplyOrderDeleteFirst), string(porkbun.ApplyOrderCreateFirst))
+	zoneConcurrency       = kingpin.Flag("zone-concurrency", "How many zones are changed at the same time").Default("1").Envar("ZONE_CONCURRENCY").Int()
+	recordConcurrency     = kingpin.Flag("record-concurrency", "How many record changes are sent to Porkbun at the same time for each zone being changed").Default("1").Envar("RECORD_CONCURRENCY").Int()
+	globalConcurrency     = kingpin.Flag("global-record-concurrency", "How many record changes are sent to Porkbun at the same time across all zones (default: no cap besides zone-concurrency times record-concurrency)").Default("0").Envar("GLOBAL_RECORD_CONCURRENCY").Int()
+	apiRetries            = kingpin.Flag("api-retries", "How often a Porkbun API call failing with a transient error, e.g. rate limiting, is retried").Default("3").Envar("API_RETRIES").Int()
+	apiRetryDelay         = kingpin.Flag("api-retry-delay", "Delay before the first retry of a Porkbun API call, doubled with every retry").Default("1s").Envar("API_RETRY_DELAY").Duration()
+	apiRetryMaxDelay      = kingpin.Flag("api-retry-max-delay", "Maximum delay before a retry of a Porkbun API call").Default("30s").Envar("API_RETRY_MAX_DELAY").Duration()
+	apiRateLimit          = kingpin.Flag("api-rate-limit", "Maximum average number of Porkbun API calls per second, shared by all calls (default: unlimited)").Default("0").Envar("API_RATE_LIMIT").Float64()
+	apiRateBurst          = kingpin.Flag("api-rate-burst", "Number of Porkbun API calls that may exceed api-rate-limit in a burst").Default("1").Envar("API_RATE_BURST").Int()
+	apiBaseURL            = kingpin.Flag("api-base-url", "Base URL of the Porkbun API, e.g. of a staging stand-in (default: https://api.porkbun.com/api/json/v3/)").Default("").Envar("API_BASE_URL").String()
+	apiProxyURL           = kingpin.Flag("api-proxy-url", "Proxy for Porkbun API calls (default: from the HTTPS_PROXY and NO_PROXY environment variables)").Default("").Envar("API_PROXY_URL").String()
+	apiCAFile             = kingpin.Flag("api-ca-file", "Path to a PEM file with CA certificates trusted for Porkbun API calls in addition to the system roots").Default("").Envar("API_CA_FILE").String()
+	apiTimeout            = kingpin.Flag("api-timeout", "Timeout of a single Porkbun API call, including reading the response").Default("10s").Envar("API_TIMEOUT").Duration()
+	apiConnectTimeout     = kingpin.Flag("api-connect-timeout", "Timeout for connecting to the Porkbun API, including the TLS handshake").Default("10s").Envar("API_CONNECT_TIMEOUT").Duration()
+	aliasRecords          = kingpin.Flag("alias-records", "Write CNAME endpoints at the zone apex or with the porkbun/alias=true property as Porkbun ALIAS records").Default("false").Envar("ALIAS_RECORDS").Bool()
 )
 
 func main() {
@@ -152,11 +175,46 @@ func buildWebhookServer(logger *slog.Logger) (*http.ServeMux, error) {
 	var recordsPath = "/records"
 	var adjustEndpointsPath = "/adjustendpoints"
 
-	pbProvider, err := porkbun.NewPorkbunProvider(*domainFilter, *apiKey, *apiSecret, *dryRun, logger)
+	var config *porkbun.Config
+	if *zoneConfig != "" {
+		var err error
+		config, err = porkbun.LoadConfig(*zoneConfig)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	pbProvider, err := porkbun.NewPorkbunProvider(*domainFilter, *apiKey, *apiSecret, *dryRun, logger,
+		porkbun.WithAliasRecords(*aliasRecords),
+		porkbun.WithConfig(config),
+		porkbun.WithProtectedRecords(*protectedRecords),
+		porkbun.WithManagedRecordTypes(*managedRecordTypes),
+		porkbun.WithApplyOrder(porkbun.ApplyOrder(*applyOrder)),
+		porkbun.WithConcurrency(*zoneConcurrency, *recordConcurrency),
+		porkbun.WithGlobalConcurrency(*globalConcurrency),
+		porkbun.WithRetries(*apiRetries, *apiRetryDelay, *apiRetryMaxDelay),
+		porkbun.WithRateLimit(*apiRateLimit, *apiRateBurst),
+		porkbun.WithBaseURL(*apiBaseURL),
+		porkbun.WithHTTPClient(porkbun.HTTPClientConfig{
+			ProxyURL:       *apiProxyURL,
+			CAFile:         *apiCAFile,
+			Timeout:        *apiTimeout,
+			ConnectTimeout: *apiConnectTimeout,
+		}),
+		porkbun.WithDomainExclusions(*excludeDomains),
+		porkbun.WithRegexDomainFilter(*regexDomainFilter, *regexDomainExclusion),
+		porkbun.WithZoneDiscovery(*zoneDiscovery, *zoneDiscoveryInterval),
+	)
 	if err != nil {
 		return nil, err
 	}
 
+	// With zone discovery, bad credentials or a failing domain listing stop the
+	// webhook at startup instead of failing the first sync.
+	if err := pbProvider.DiscoverZones(context.Background()); err != nil {
+		return nil, err
+	}
+
 	p := webhook.WebhookServer{
 		Provider: pbProvider,
 	}
@@ -0,0 +1,115 @@
+package porkbun
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	pb "github.com/nrdcg/porkbun"
+)
+
+// Client is the part of the Porkbun API the provider uses. It is implemented by
+// *porkbun.Client and can be implemented by fakes for testing or by decorators of
+// another Client, e.g. for caching.
+type Client interface {
+	Ping(ctx context.Context) (string, error)
+	RetrieveRecords(ctx context.Context, domain string) ([]pb.Record, error)
+	CreateRecord(ctx context.Context, domain string, record pb.Record) (int, error)
+	EditRecord(ctx context.Context, domain string, id int, record pb.Record) error
+	DeleteRecord(ctx context.Context, domain string, id int) error
+}
+
+// domainLister is implemented by clients that list the domains of the account for
+// zone discovery themselves.
+type domainLister interface {
+	ListDomains(ctx context.Context) ([]string, error)
+}
+
+// The Porkbun API is only called through the methods below, which pace the calls
+// with the rate limiter and retry failed calls as configured.
+
+// call calls the Porkbun API with fn once the rate limiter allows it, retrying as
+// configured. Every attempt waits for the rate limiter.
+func (p *PorkbunProvider) call(ctx context.Context, operation string, idempotent bool, fn func() error) error {
+	return p.withRetries(ctx, operation, idempotent, func() error {
+		if err := p.waitForRateLimit(ctx, operation); err != nil {
+			return err
+		}
+		return fn()
+	})
+}
+
+// waitForRateLimit blocks until the rate limiter allows another call to Porkbun.
+func (p *PorkbunProvider) waitForRateLimit(ctx context.Context, operation string) error {
+	if p.rateLimiter == nil {
+		return nil
+	}
+	start := time.Now()
+	err := p.rateLimiter.Wait(ctx)
+	apiRateLimitWait.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	return err
+}
+
+func (p *PorkbunProvider) ping(ctx context.Context) error {
+	return p.call(ctx, "ping", true, func() error {
+		_, err := p.client.Ping(ctx)
+		return err
+	})
+}
+
+func (p *PorkbunProvider) retrieveRecords(ctx context.Context, zone string) ([]pb.Record, error) {
+	var records []pb.Record
+	err := p.call(ctx, "retrieve", true, func() error {
+		var err error
+		records, err = p.client.RetrieveRecords(ctx, zone)
+		return err
+	})
+	return records, err
+}
+
+func (p *PorkbunProvider) createRecord(ctx context.Context, zone string, record pb.Record) (int, error) {
+	var id int
+	err := p.call(ctx, "create", false, func() error {
+		var err error
+		id, err = p.client.CreateRecord(ctx, zone, record)
+		return err
+	})
+	return id, err
+}
+
+func (p *PorkbunProvider) editRecord(ctx context.Context, zone string, id int, record pb.Record) error {
+	return p.call(ctx, "edit", true, func() error {
+		return p.client.EditRecord(ctx, zone, id, record)
+	})
+}
+
+// deleteRecord deletes a record. A retried delete that no longer finds the record
+// succeeds, as an earlier attempt may have deleted it before its answer was lost.
+func (p *PorkbunProvider) deleteRecord(ctx context.Context, zone string, id int) error {
+	attempts := 0
+	return p.call(ctx, "delete", true, func() error {
+		attempts++
+		err := p.client.DeleteRecord(ctx, zone, id)
+		if attempts > 1 && isRecordNotFound(err) {
+			p.logger.Debug("record already deleted by an earlier attempt", "zone", zone, "id", id)
+			return nil
+		}
+		return err
+	})
+}
+
+// isRecordNotFound reports whether Porkbun answered that the record ID is unknown.
+func isRecordNotFound(err error) bool {
+	status, ok := porkbunStatus(err)
+	return ok && strings.Contains(strings.ToLower(status.Message), "invalid record id")
+}
+
+func (p *PorkbunProvider) listZones(ctx context.Context) ([]string, error) {
+	var domains []string
+	err := p.call(ctx, "listDomains", true, func() error {
+		var err error
+		domains, err = p.listDomains(ctx)
+		return err
+	})
+	return domains, err
+}
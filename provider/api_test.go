@@ -0,0 +1,210 @@
+package porkbun
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/porkbuntest"
+	pb "github.com/nrdcg/porkbun"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClient is a Client keeping the records of its domains in memory. Records are
+// given and reported with fully qualified names, as Porkbun does. Every call is
+// logged and the calls listed in errs fail with the given error.
+type fakeClient struct {
+	mu      sync.Mutex
+	records map[string][]pb.Record
+	errs    map[string]error
+	calls   []string
+	nextID  int
+}
+
+var _ Client = (*fakeClient)(nil)
+
+func newFakeClient(records map[string][]pb.Record) *fakeClient {
+	return &fakeClient{records: records, errs: map[string]error{}, nextID: 1000}
+}
+
+func (c *fakeClient) called(call string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, call)
+	return c.errs[call]
+}
+
+func (c *fakeClient) Ping(_ context.Context) (string, error) {
+	return "127.0.0.1", c.called("ping")
+}
+
+func (c *fakeClient) ListDomains(_ context.Context) ([]string, error) {
+	if err := c.called("listDomains"); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	domains := make([]string, 0, len(c.records))
+	for domain := range c.records {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains, nil
+}
+
+func (c *fakeClient) RetrieveRecords(_ context.Context, domain string) ([]pb.Record, error) {
+	if err := c.called("retrieve " + domain); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]pb.Record(nil), c.records[domain]...), nil
+}
+
+func (c *fakeClient) CreateRecord(_ context.Context, domain string, record pb.Record) (int, error) {
+	if err := c.called(fmt.Sprintf("create %s %s %s %s", domain, record.Name, record.Type, record.Content)); err != nil {
+		return 0, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	record.ID = strconv.Itoa(c.nextID)
+	record.Name = fakeFQDN(record.Name, domain)
+	c.records[domain] = append(c.records[domain], record)
+	return c.nextID, nil
+}
+
+func (c *fakeClient) EditRecord(_ context.Context, domain string, id int, record pb.Record) error {
+	if err := c.called(fmt.Sprintf("edit %s %d %s %s %s", domain, id, record.Name, record.Type, record.Content)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, rec := range c.records[domain] {
+		if rec.ID == strconv.Itoa(id) {
+			record.ID = rec.ID
+			record.Name = fakeFQDN(record.Name, domain)
+			c.records[domain][i] = record
+			return nil
+		}
+	}
+	return pb.Status{Status: "ERROR", Message: "Invalid record ID."}
+}
+
+func (c *fakeClient) DeleteRecord(_ context.Context, domain string, id int) error {
+	if err := c.called(fmt.Sprintf("delete %s %d", domain, id)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, rec := range c.records[domain] {
+		if rec.ID == strconv.Itoa(id) {
+			c.records[domain] = append(c.records[domain][:i], c.records[domain][i+1:]...)
+			return nil
+		}
+	}
+	return pb.Status{Status: "ERROR", Message: "Invalid record ID."}
+}
+
+func fakeFQDN(name string, domain string) string {
+	if name == "" {
+		return domain
+	}
+	return name + "." + domain
+}
+
+func TestRateLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	_, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRateLimit(-1, 1))
+	assert.Error(t, err)
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRateLimit(10, 0))
+	assert.Error(t, err)
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRateLimit(0, 0))
+	assert.NoError(t, err)
+	assert.Nil(t, p.rateLimiter)
+
+	// 20 calls per second without bursts, concurrent calls share the limit
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRateLimit(20, 1))
+	assert.NoError(t, err)
+
+	waits := rateLimitWaitCount(t, "ratelimit-test")
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, p.call(context.TODO(), "ratelimit-test", true, func() error { return nil }))
+		}()
+	}
+	wg.Wait()
+	assert.GreaterOrEqual(t, time.Since(start), 190*time.Millisecond)
+	assert.Equal(t, waits+5, rateLimitWaitCount(t, "ratelimit-test"))
+
+	// waiting ends with the context
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	called := false
+	assert.Error(t, p.call(ctx, "ratelimit-test", true, func() error { called = true; return nil }))
+	assert.False(t, called)
+}
+
+// rateLimitWaitCount returns how many waits for the rate limiter were observed for the
+// operation.
+func rateLimitWaitCount(t *testing.T, operation string) uint64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	assert.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "external_dns_porkbun_api_rate_limit_wait_seconds" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "operation" && label.GetValue() == operation {
+					return metric.GetHistogram().GetSampleCount()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestDeleteRecord(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := porkbuntest.NewServer("KEY", "SECRET")
+	defer server.Close()
+	server.AddDomain("example.com", pb.Record{ID: "1", Name: "www", Type: "A", Content: "1.1.1.1"})
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger,
+		WithBaseURL(server.URL), WithRetries(2, time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+
+	// the retry of a deletion whose answer was lost finds the record deleted
+	server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs("delete example.com 1"), StatusCode: http.StatusGatewayTimeout, Applied: true})
+	assert.NoError(t, p.deleteRecord(context.TODO(), "example.com", 1))
+	assert.Equal(t, []string{"delete example.com 1", "delete example.com 1"}, server.MutationLog())
+	assert.Empty(t, server.Records("example.com"))
+
+	// deleting an unknown record without a retry still fails
+	err = p.deleteRecord(context.TODO(), "example.com", 1)
+	assert.True(t, isRecordNotFound(err))
+}
+
+func TestIsRecordNotFound(t *testing.T) {
+	assert.True(t, isRecordNotFound(pb.Status{Status: "ERROR", Message: "Invalid record ID."}))
+	assert.True(t, isRecordNotFound(fmt.Errorf("unable to delete record: %w", &pb.ServerError{StatusCode: 400, Message: `{"status":"ERROR","message":"Invalid record ID."}`})))
+	assert.False(t, isRecordNotFound(&pb.ServerError{StatusCode: 400, Message: `{"status":"ERROR","message":"Invalid domain."}`}))
+	assert.False(t, isRecordNotFound(&pb.ServerError{StatusCode: 404, Message: "Invalid record ID."}))
+	assert.False(t, isRecordNotFound(nil))
+}
@@ -0,0 +1,141 @@
+package porkbun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/dnsname"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/yaml"
+)
+
+// Config is the optional configuration file of the provider.
+type Config struct {
+	// Zones holds the settings per zone, keyed by the zone name.
+	Zones map[string]ZoneConfig `json:"zones"`
+}
+
+// ZoneConfig holds the settings of a single zone.
+type ZoneConfig struct {
+	// DefaultTTL is used for endpoints without a TTL.
+	DefaultTTL endpoint.TTL `json:"defaultTTL,omitempty"`
+	// MinTTL raises lower TTLs, it has to be at least Porkbun's minimum of 600 seconds.
+	MinTTL endpoint.TTL `json:"minTTL,omitempty"`
+	// AllowedTypes limits the record types that may be written, all supported types are allowed if empty.
+	AllowedTypes []string `json:"allowedTypes,omitempty"`
+	// ReadOnly refuses all changes to the zone.
+	ReadOnly bool `json:"readOnly,omitempty"`
+	// ProtectedRecords are rules of the form "<name pattern> [<type>]" for records that
+	// are never changed, with glob patterns relative to the zone and "@" for the apex.
+	ProtectedRecords []string `json:"protectedRecords,omitempty"`
+}
+
+// LoadConfig reads a YAML or JSON configuration file and validates it.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+
+	config := &Config{}
+	err = yaml.UnmarshalStrict(data, config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+
+	err = config.normalize()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// normalize validates the configuration and brings zone names, record types and
+// record names into their canonical form. All problems are reported at once.
+func (c *Config) normalize() error {
+	var errs []error
+
+	zones := make(map[string]ZoneConfig, len(c.Zones))
+	for name, zone := range c.Zones {
+		zoneName := dnsname.Normalize(name)
+		if zoneName == "" {
+			errs = append(errs, fmt.Errorf("zone name must not be empty"))
+			continue
+		}
+		if _, ok := zones[zoneName]; ok {
+			errs = append(errs, fmt.Errorf("zone %s: configured more than once", zoneName))
+			continue
+		}
+
+		if zone.MinTTL != 0 && zone.MinTTL < porkbunMinTTL {
+			errs = append(errs, fmt.Errorf("zone %s: minTTL %d is below the Porkbun minimum of %d", zoneName, zone.MinTTL, porkbunMinTTL))
+		}
+		if zone.DefaultTTL < 0 {
+			errs = append(errs, fmt.Errorf("zone %s: defaultTTL %d must not be negative", zoneName, zone.DefaultTTL))
+		} else if zone.DefaultTTL != 0 && zone.DefaultTTL < max(zone.MinTTL, porkbunMinTTL) {
+			errs = append(errs, fmt.Errorf("zone %s: defaultTTL %d is below the minimum TTL of %d", zoneName, zone.DefaultTTL, max(zone.MinTTL, porkbunMinTTL)))
+		}
+
+		for i, recordType := range zone.AllowedTypes {
+			recordType = strings.ToUpper(strings.TrimSpace(recordType))
+			if !supportedRecordTypes[recordType] {
+				errs = append(errs, fmt.Errorf("zone %s: record type %q is not supported", zoneName, zone.AllowedTypes[i]))
+			}
+			zone.AllowedTypes[i] = recordType
+		}
+
+		for i, rule := range zone.ProtectedRecords {
+			parsed, err := parseProtectionRule(rule)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("zone %s: %w", zoneName, err))
+				continue
+			}
+			zone.ProtectedRecords[i] = parsed.String()
+		}
+
+		zones[zoneName] = zone
+	}
+	c.Zones = zones
+
+	return errors.Join(errs...)
+}
+
+// Zone returns the settings of a zone, which are empty if the zone is not configured.
+func (c *Config) Zone(name string) ZoneConfig {
+	if c == nil {
+		return ZoneConfig{}
+	}
+	return c.Zones[dnsname.Normalize(name)]
+}
+
+// minTTL returns the lowest TTL that may be written to the zone.
+func (z ZoneConfig) minTTL() endpoint.TTL {
+	return max(z.MinTTL, porkbunMinTTL)
+}
+
+// ttl returns the TTL written to the zone for an endpoint TTL: the default TTL if the
+// endpoint has none, raised to the minimum TTL of the zone.
+func (z ZoneConfig) ttl(ttl endpoint.TTL) endpoint.TTL {
+	if !ttl.IsConfigured() && z.DefaultTTL.IsConfigured() {
+		ttl = z.DefaultTTL
+	}
+	if ttl.IsConfigured() && ttl < z.minTTL() {
+		ttl = z.minTTL()
+	}
+	return ttl
+}
+
+// allowsType reports whether records of the type may be written to the zone.
+func (z ZoneConfig) allowsType(recordType string) bool {
+	if len(z.AllowedTypes) == 0 {
+		return true
+	}
+	for _, allowed := range z.AllowedTypes {
+		if allowed == recordType {
+			return true
+		}
+	}
+	return false
+}
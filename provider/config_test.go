@@ -0,0 +1,93 @@
+package porkbun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func writeConfig(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0o600)
+	assert.NoError(t, err)
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, "config.yaml", `
+zones:
+  Example.com.:
+    defaultTTL: 3600
+    minTTL: 900
+    allowedTypes: [a, AAAA, CNAME, TXT]
+    protectedRecords: ["@", "Mail", "_dmarc txt"]
+  example.org:
+    readOnly: true
+`)
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, &Config{
+		Zones: map[string]ZoneConfig{
+			"example.com": {
+				DefaultTTL:       3600,
+				MinTTL:           900,
+				AllowedTypes:     []string{"A", "AAAA", "CNAME", "TXT"},
+				ProtectedRecords: []string{"@", "mail", "_dmarc TXT"},
+			},
+			"example.org": {
+				ReadOnly: true,
+			},
+		},
+	}, config)
+
+	assert.Equal(t, endpoint.TTL(3600), config.Zone("EXAMPLE.com").DefaultTTL)
+	assert.True(t, config.Zone("example.org").ReadOnly)
+	assert.Equal(t, ZoneConfig{}, config.Zone("example.net"))
+	assert.Equal(t, ZoneConfig{}, (*Config)(nil).Zone("example.com"))
+
+	// JSON works as well
+	path = writeConfig(t, "config.json", `{"zones": {"example.com": {"readOnly": true}}}`)
+	config, err = LoadConfig(path)
+	assert.NoError(t, err)
+	assert.True(t, config.Zone("example.com").ReadOnly)
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown field", content: "zones:\n  example.com:\n    protected: [mail]\n", wantErr: `unknown field "protected"`},
+		{name: "invalid yaml", content: "zones: [", wantErr: "unable to parse config file"},
+		{name: "wrong type", content: "zones:\n  example.com:\n    defaultTTL: soon\n", wantErr: "unable to parse config file"},
+		{name: "min TTL too low", content: "zones:\n  example.com:\n    minTTL: 60\n", wantErr: "zone example.com: minTTL 60 is below the Porkbun minimum of 600"},
+		{name: "default TTL below min TTL", content: "zones:\n  example.com:\n    minTTL: 900\n    defaultTTL: 600\n", wantErr: "zone example.com: defaultTTL 600 is below the minimum TTL of 900"},
+		{name: "negative default TTL", content: "zones:\n  example.com:\n    defaultTTL: -1\n", wantErr: "zone example.com: defaultTTL -1 must not be negative"},
+		{name: "unsupported type", content: "zones:\n  example.com:\n    allowedTypes: [A, PTR]\n", wantErr: `zone example.com: record type "PTR" is not supported`},
+		{name: "empty protected record", content: "zones:\n  example.com:\n    protectedRecords: [\"\"]\n", wantErr: `zone example.com: invalid protected record ""`},
+		{name: "invalid protected record type", content: "zones:\n  example.com:\n    protectedRecords: [\"@ PTR\"]\n", wantErr: `zone example.com: invalid protected record "@ PTR", record type PTR is not supported`},
+		{name: "duplicate zone", content: "zones:\n  example.com: {}\n  Example.com.: {}\n", wantErr: "zone example.com: configured more than once"},
+		{name: "empty zone name", content: "zones:\n  \".\": {}\n", wantErr: "zone name must not be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, "config.yaml", tt.content))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	_, err := LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "unable to read config file")
+
+	// all problems are reported at once
+	_, err = LoadConfig(writeConfig(t, "config.yaml", "zones:\n  example.com:\n    minTTL: 60\n    allowedTypes: [PTR]\n"))
+	assert.ErrorContains(t, err, "minTTL 60")
+	assert.ErrorContains(t, err, `record type "PTR"`)
+}
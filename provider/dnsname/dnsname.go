@@ -0,0 +1,68 @@
+// Package dnsname maps between the fully qualified domain names used by external-dns
+// and the subdomain names of Porkbun records.
+//
+// All names are compared in their canonical form: lower case, without a trailing
+// dot and with internationalized labels encoded as punycode. The apex of a zone is
+// the empty subdomain, wildcard labels ("*") are kept as they are.
+package dnsname
+
+import (
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Normalize returns the canonical form of a DNS name.
+func Normalize(name string) string {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return ""
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		label = strings.ToLower(label)
+		if ascii, err := idna.Punycode.ToASCII(label); err == nil {
+			label = ascii
+		}
+		labels[i] = label
+	}
+	return strings.Join(labels, ".")
+}
+
+// IsSubdomain reports whether name is the zone itself or lies below it. Names are
+// compared on label boundaries, so "foobar.org" is not a subdomain of "bar.org".
+func IsSubdomain(name, zone string) bool {
+	name, zone = Normalize(name), Normalize(zone)
+	if zone == "" {
+		return false
+	}
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// ToPorkbun returns the Porkbun subdomain of fqdn within zone, which is empty for
+// the zone apex. The second return value is false if fqdn does not belong to zone.
+func ToPorkbun(fqdn, zone string) (string, bool) {
+	fqdn, zone = Normalize(fqdn), Normalize(zone)
+	if !IsSubdomain(fqdn, zone) {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(fqdn, zone), "."), true
+}
+
+// FromPorkbun returns the fully qualified name of a Porkbun record in zone. The
+// Porkbun API reports record names fully qualified, but names relative to the zone
+// and "@" for the apex are accepted as well.
+func FromPorkbun(name, zone string) string {
+	name, zone = Normalize(name), Normalize(zone)
+	switch {
+	case name == "" || name == "@":
+		return zone
+	case strings.HasPrefix(name, "@."):
+		return FromPorkbun(strings.TrimPrefix(name, "@."), zone)
+	case IsSubdomain(name, zone):
+		return name
+	default:
+		return name + "." + zone
+	}
+}
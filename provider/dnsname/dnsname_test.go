@@ -0,0 +1,124 @@
+package dnsname
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "www.example.com", want: "www.example.com"},
+		{name: "trailing dot", in: "www.example.com.", want: "www.example.com"},
+		{name: "mixed case", in: "WWW.Example.COM", want: "www.example.com"},
+		{name: "wildcard", in: "*.Example.com.", want: "*.example.com"},
+		{name: "underscore labels", in: "_sip._TCP.example.com", want: "_sip._tcp.example.com"},
+		{name: "unicode", in: "www.bücher.example", want: "www.xn--bcher-kva.example"},
+		{name: "unicode mixed case", in: "BÜCHER.example", want: "xn--bcher-kva.example"},
+		{name: "punycode", in: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{name: "surrounding whitespace", in: " example.com ", want: "example.com"},
+		{name: "empty", in: "", want: ""},
+		{name: "root", in: ".", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Normalize(tt.in))
+		})
+	}
+}
+
+func TestIsSubdomain(t *testing.T) {
+	tests := []struct {
+		name string
+		fqdn string
+		zone string
+		want bool
+	}{
+		{name: "apex", fqdn: "example.com", zone: "example.com", want: true},
+		{name: "subdomain", fqdn: "www.example.com", zone: "example.com", want: true},
+		{name: "deep subdomain", fqdn: "a.b.c.example.com", zone: "example.com", want: true},
+		{name: "wildcard", fqdn: "*.example.com", zone: "example.com", want: true},
+		{name: "trailing dots and case", fqdn: "WWW.example.com.", zone: "Example.COM.", want: true},
+		{name: "unicode against punycode", fqdn: "www.bücher.example", zone: "xn--bcher-kva.example", want: true},
+		{name: "lookalike suffix", fqdn: "foobar.org", zone: "bar.org", want: false},
+		{name: "lookalike subdomain", fqdn: "www.foobar.org", zone: "bar.org", want: false},
+		{name: "parent", fqdn: "example.com", zone: "sub.example.com", want: false},
+		{name: "other zone", fqdn: "www.example.org", zone: "example.com", want: false},
+		{name: "empty zone", fqdn: "example.com", zone: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsSubdomain(tt.fqdn, tt.zone))
+		})
+	}
+}
+
+func TestToPorkbun(t *testing.T) {
+	tests := []struct {
+		name   string
+		fqdn   string
+		zone   string
+		want   string
+		wantOK bool
+	}{
+		{name: "apex", fqdn: "example.com", zone: "example.com", want: "", wantOK: true},
+		{name: "apex with trailing dot", fqdn: "example.com.", zone: "example.com", want: "", wantOK: true},
+		{name: "subdomain", fqdn: "www.example.com", zone: "example.com", want: "www", wantOK: true},
+		{name: "nested subdomain", fqdn: "a.b.example.com", zone: "example.com", want: "a.b", wantOK: true},
+		{name: "wildcard", fqdn: "*.example.com", zone: "example.com", want: "*", wantOK: true},
+		{name: "nested wildcard", fqdn: "*.k8s.example.com", zone: "example.com", want: "*.k8s", wantOK: true},
+		{name: "mixed case", fqdn: "WWW.EXAMPLE.com", zone: "example.COM", want: "www", wantOK: true},
+		{name: "unicode subdomain", fqdn: "bücher.example.com", zone: "example.com", want: "xn--bcher-kva", wantOK: true},
+		{name: "unicode zone", fqdn: "www.bücher.example", zone: "xn--bcher-kva.example", want: "www", wantOK: true},
+		{name: "zone name repeated in subdomain", fqdn: "example.com.example.com", zone: "example.com", want: "example.com", wantOK: true},
+		{name: "lookalike", fqdn: "foobar.org", zone: "bar.org", wantOK: false},
+		{name: "other zone", fqdn: "www.example.org", zone: "example.com", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToPorkbun(tt.fqdn, tt.zone)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestFromPorkbun(t *testing.T) {
+	tests := []struct {
+		name   string
+		record string
+		zone   string
+		want   string
+	}{
+		{name: "fully qualified", record: "www.example.com", zone: "example.com", want: "www.example.com"},
+		{name: "fully qualified apex", record: "example.com", zone: "example.com", want: "example.com"},
+		{name: "empty apex", record: "", zone: "example.com", want: "example.com"},
+		{name: "at apex", record: "@", zone: "example.com", want: "example.com"},
+		{name: "at prefixed apex", record: "@.example.com", zone: "example.com", want: "example.com"},
+		{name: "relative", record: "www", zone: "example.com", want: "www.example.com"},
+		{name: "relative wildcard", record: "*", zone: "example.com", want: "*.example.com"},
+		{name: "fully qualified wildcard", record: "*.example.com", zone: "example.com", want: "*.example.com"},
+		{name: "mixed case", record: "WWW.Example.com", zone: "EXAMPLE.com.", want: "www.example.com"},
+		{name: "unicode zone", record: "www.xn--bcher-kva.example", zone: "bücher.example", want: "www.xn--bcher-kva.example"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, FromPorkbun(tt.record, tt.zone))
+		})
+	}
+
+	// round trip
+	for _, fqdn := range []string{"example.com", "www.example.com", "*.example.com", "*.a.b.example.com"} {
+		sub, ok := ToPorkbun(fqdn, "example.com")
+		assert.True(t, ok)
+		assert.Equal(t, fqdn, FromPorkbun(sub, "example.com"))
+	}
+}
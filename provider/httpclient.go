@@ -0,0 +1,78 @@
+package porkbun
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HTTPClientConfig configures the HTTP client the Porkbun API client sends its calls with.
+type HTTPClientConfig struct {
+	// ProxyURL is the proxy API calls are sent through. Without it the proxy is
+	// taken from the HTTPS_PROXY and NO_PROXY environment variables.
+	ProxyURL string
+	// CAFile is a PEM bundle of certificates trusted in addition to the system roots,
+	// e.g. the CA of a TLS-inspecting proxy.
+	CAFile string
+	// Timeout limits a single API call, including reading the response. Zero means
+	// no limit.
+	Timeout time.Duration
+	// ConnectTimeout limits establishing a connection and its TLS handshake. Zero
+	// keeps the defaults of net/http.
+	ConnectTimeout time.Duration
+}
+
+// WithHTTPClient sends the API calls with an HTTP client built from config instead
+// of the default client of the Porkbun API client. It has no effect on a client
+// passed with WithClient.
+func WithHTTPClient(config HTTPClientConfig) Option {
+	return func(p *PorkbunProvider) {
+		p.httpClientConfig = &config
+	}
+}
+
+// newHTTPClient builds an HTTP client from config, starting from the defaults of
+// http.DefaultTransport.
+func newHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	if config.Timeout < 0 || config.ConnectTimeout < 0 {
+		return nil, fmt.Errorf("invalid HTTP client timeouts, got %s per call and %s to connect", config.Timeout, config.ConnectTimeout)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.ProxyURL != "" {
+		proxyURL, err := url.Parse(config.ProxyURL)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", config.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if config.CAFile != "" {
+		bundle, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+
+	if config.ConnectTimeout > 0 {
+		dialer := &net.Dialer{Timeout: config.ConnectTimeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = config.ConnectTimeout
+	}
+
+	return &http.Client{Transport: transport, Timeout: config.Timeout}, nil
+}
@@ -0,0 +1,99 @@
+package porkbun
+
+import (
+	"context"
+	"encoding/pem"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/porkbuntest"
+	pb "github.com/nrdcg/porkbun"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+)
+
+func TestHTTPClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	t.Run("Proxy", func(t *testing.T) {
+		// The fake answers requests for any host, so it stands in for the proxy.
+		proxy := porkbuntest.NewServer("KEY", "SECRET")
+		defer proxy.Close()
+		proxy.AddDomain("example.com", pb.Record{Name: "www", Type: "A", Content: "1.1.1.1"})
+
+		p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger,
+			WithBaseURL("http://porkbun.invalid/"),
+			WithHTTPClient(HTTPClientConfig{ProxyURL: proxy.URL}),
+		)
+		assert.NoError(t, err)
+
+		records, err := p.Records(context.TODO())
+		assert.NoError(t, err)
+		assert.Equal(t, []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		}, records)
+		assert.Equal(t, porkbuntest.Request{Operation: porkbuntest.OperationRetrieve, Domain: "example.com"}, proxy.Requests()[len(proxy.Requests())-1])
+	})
+
+	t.Run("CAFile", func(t *testing.T) {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"status":"SUCCESS","yourIp":"127.0.0.1"}`))
+		}))
+		server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		server.StartTLS()
+		defer server.Close()
+
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+		ping := func(opts ...Option) error {
+			p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, append(opts, WithBaseURL(server.URL), WithRetries(0, 0, 0))...)
+			assert.NoError(t, err)
+			return p.ping(context.TODO())
+		}
+
+		assert.ErrorContains(t, ping(), "certificate")
+		assert.NoError(t, ping(WithHTTPClient(HTTPClientConfig{CAFile: caFile})))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		server := porkbuntest.NewServer("KEY", "SECRET")
+		defer server.Close()
+		server.SetLatency(time.Second)
+
+		p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger,
+			WithBaseURL(server.URL),
+			WithHTTPClient(HTTPClientConfig{Timeout: 20 * time.Millisecond, ConnectTimeout: time.Second}),
+			WithRetries(0, 0, 0),
+		)
+		assert.NoError(t, err)
+
+		err = p.ping(context.TODO())
+		assert.ErrorContains(t, err, "Client.Timeout exceeded")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		caFile := filepath.Join(t.TempDir(), "ca.pem")
+		assert.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+		for _, tc := range []struct {
+			config HTTPClientConfig
+			err    string
+		}{
+			{HTTPClientConfig{ProxyURL: "proxy.example.com:3128"}, `invalid proxy URL "proxy.example.com:3128"`},
+			{HTTPClientConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")}, "unable to read CA bundle"},
+			{HTTPClientConfig{CAFile: caFile}, "no certificates found in CA bundle " + caFile},
+			{HTTPClientConfig{Timeout: -time.Second}, "invalid HTTP client timeouts, got -1s per call and 0s to connect"},
+		} {
+			_, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithHTTPClient(tc.config))
+			assert.ErrorContains(t, err, tc.err)
+		}
+	})
+}
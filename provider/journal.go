@@ -0,0 +1,130 @@
+package porkbun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/dnsname"
+	pb "github.com/nrdcg/porkbun"
+)
+
+// rollbackTimeout bounds the rollback of a zone, which also runs when the context of
+// the failed apply is already canceled.
+const rollbackTimeout = time.Minute
+
+// journalEntry is a mutation applied to a zone together with what is needed to undo it.
+type journalEntry struct {
+	action string
+	// id is the ID of the created or updated record.
+	id int
+	// record is the original content of the deleted or updated record.
+	record pb.Record
+}
+
+// zoneJournal records the mutations applied to a zone so that they can be undone in
+// reverse order when a later mutation fails. A nil journal records nothing. The
+// mutations of a zone may be journaled concurrently.
+type zoneJournal struct {
+	zone     string
+	original map[string]pb.Record
+
+	mu      sync.Mutex
+	entries []journalEntry
+}
+
+// newZoneJournal creates a journal for the zone, recs being the records of the zone
+// before any mutation.
+func newZoneJournal(zone string, recs []pb.Record) *zoneJournal {
+	original := make(map[string]pb.Record, len(recs))
+	for _, rec := range recs {
+		original[rec.ID] = rec
+	}
+	return &zoneJournal{zone: zone, original: original}
+}
+
+func (j *zoneJournal) created(id int, record pb.Record) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, journalEntry{action: "create", id: id, record: record})
+}
+
+func (j *zoneJournal) deleted(record pb.Record) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if original, ok := j.original[record.ID]; ok {
+		record = original
+	}
+	j.entries = append(j.entries, journalEntry{action: "delete", record: record})
+}
+
+func (j *zoneJournal) updated(id int) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, journalEntry{action: "update", id: id, record: j.original[strconv.Itoa(id)]})
+}
+
+// restorable returns the original content of a deleted or updated record in the form
+// Porkbun expects when creating or editing it.
+func (j *zoneJournal) restorable(record pb.Record) pb.Record {
+	record.ID = ""
+	record.Name, _ = dnsname.ToPorkbun(dnsname.FromPorkbun(record.Name, j.zone), j.zone)
+	return record
+}
+
+// rollback undoes the journaled mutations in reverse order after cause made the apply
+// fail. It tries to undo every mutation and returns cause together with the outcome of
+// the rollback.
+func (p *PorkbunProvider) rollback(ctx context.Context, journal *zoneJournal, cause error) error {
+	if len(journal.entries) == 0 {
+		return cause
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	p.logger.Warn("rolling back changes to zone", "zone", journal.zone, "changes", len(journal.entries), "error", cause)
+
+	var errs []error
+	for i := len(journal.entries) - 1; i >= 0; i-- {
+		entry := journal.entries[i]
+		var err error
+		switch entry.action {
+		case "create":
+			err = p.deleteRecord(ctx, journal.zone, entry.id)
+		case "delete":
+			_, err = p.createRecord(ctx, journal.zone, journal.restorable(entry.record))
+		case "update":
+			if entry.record.ID == "" {
+				err = errors.New("original content unknown")
+				break
+			}
+			err = p.editRecord(ctx, journal.zone, entry.id, journal.restorable(entry.record))
+		}
+		if err != nil {
+			p.logger.Error("unable to undo change", "zone", journal.zone, "action", entry.action, "id", entry.id, "record", entry.record, "error", err)
+			errs = append(errs, fmt.Errorf("unable to undo %s of record %s %s %s: %w", entry.action, entry.record.Name, entry.record.Type, entry.record.Content, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		zoneRollbacks.WithLabelValues(journal.zone, "failure").Inc()
+		return errors.Join(cause, fmt.Errorf("rollback of zone %s incomplete, %d of %d changes not undone: %w", journal.zone, len(errs), len(journal.entries), errors.Join(errs...)))
+	}
+
+	zoneRollbacks.WithLabelValues(journal.zone, "success").Inc()
+	p.logger.Info("rolled back changes to zone", "zone", journal.zone, "changes", len(journal.entries))
+	return fmt.Errorf("%w (rolled back %d changes)", cause, len(journal.entries))
+}
@@ -0,0 +1,141 @@
+package porkbun
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/porkbuntest"
+	pb "github.com/nrdcg/porkbun"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/external-dns/endpoint"
+	"sigs.k8s.io/external-dns/plan"
+)
+
+// journalTestServer serves example.com with a few A records and fails the requests
+// listed in fail.
+func journalTestServer(t *testing.T, fail ...string) *porkbuntest.Server {
+	server := porkbuntest.NewServer("KEY", "SECRET")
+	t.Cleanup(server.Close)
+
+	server.AddDomain("example.com",
+		pb.Record{ID: "1", Name: "old", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		pb.Record{ID: "2", Name: "www", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		pb.Record{ID: "3", Name: "gone", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	)
+	for _, request := range fail {
+		server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs(request), Message: "failed"})
+	}
+	return server
+}
+
+func journalTestProvider(t *testing.T, server *porkbuntest.Server, opts ...Option) *PorkbunProvider {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, append(opts, WithBaseURL(server.URL))...)
+	assert.NoError(t, err)
+	return p
+}
+
+func TestRollback(t *testing.T) {
+	t.Run("delete first", func(t *testing.T) {
+		server := journalTestServer(t, "create example.com new A 3.3.3.3 600")
+		p := journalTestProvider(t, server)
+		before := testutil.ToFloat64(zoneRollbacks.WithLabelValues("example.com", "success"))
+
+		err := applyChangesToZone(context.TODO(), &plan.Changes{
+			Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", endpoint.RecordTypeA, 600, "2.2.2.2", "3.3.3.3")},
+			Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+		}, p, "example.com")
+		assert.ErrorContains(t, err, "unable to create records")
+		assert.ErrorContains(t, err, "rolled back 2 changes")
+
+		assert.Equal(t, []string{
+			"delete example.com 1",
+			"create example.com new A 2.2.2.2 600",
+			"create example.com new A 3.3.3.3 600",
+			// rollback
+			"delete example.com 101",
+			"create example.com old A 1.1.1.1 600",
+		}, server.MutationLog())
+		assert.Equal(t, []pb.Record{
+			{ID: "2", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+			{ID: "3", Name: "gone.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+			{ID: "102", Name: "old.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		}, server.Records("example.com"))
+		assert.Equal(t, before+1, testutil.ToFloat64(zoneRollbacks.WithLabelValues("example.com", "success")))
+	})
+
+	t.Run("create first", func(t *testing.T) {
+		server := journalTestServer(t, "delete example.com 3")
+		p := journalTestProvider(t, server, WithApplyOrder(ApplyOrderCreateFirst))
+
+		err := applyChangesToZone(context.TODO(), &plan.Changes{
+			Create:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", endpoint.RecordTypeA, 600, "2.2.2.2")},
+			UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+			UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 900, "1.1.1.1")},
+			Delete:    []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("gone.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+		}, p, "example.com")
+		assert.ErrorContains(t, err, "unable to delete records")
+		assert.ErrorContains(t, err, "rolled back 2 changes")
+
+		assert.Equal(t, []string{
+			"create example.com new A 2.2.2.2 600",
+			"edit example.com 2 www A 1.1.1.1 900",
+			"delete example.com 3",
+			// rollback
+			"edit example.com 2 www A 1.1.1.1 600",
+			"delete example.com 101",
+		}, server.MutationLog())
+	})
+
+	t.Run("incomplete rollback", func(t *testing.T) {
+		server := journalTestServer(t, "create example.com new A 2.2.2.2 600", "create example.com old A 1.1.1.1 600")
+		p := journalTestProvider(t, server)
+		before := testutil.ToFloat64(zoneRollbacks.WithLabelValues("example.com", "failure"))
+
+		err := applyChangesToZone(context.TODO(), &plan.Changes{
+			Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("new.example.com", endpoint.RecordTypeA, 600, "2.2.2.2")},
+			Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+		}, p, "example.com")
+		assert.ErrorContains(t, err, "unable to create records")
+		assert.ErrorContains(t, err, "rollback of zone example.com incomplete, 1 of 1 changes not undone")
+		assert.ErrorContains(t, err, "unable to undo delete of record old.example.com A 1.1.1.1")
+
+		assert.Equal(t, []string{
+			"delete example.com 1",
+			"create example.com new A 2.2.2.2 600",
+			"create example.com old A 1.1.1.1 600",
+		}, server.MutationLog())
+		assert.Equal(t, before+1, testutil.ToFloat64(zoneRollbacks.WithLabelValues("example.com", "failure")))
+	})
+
+	t.Run("nothing to roll back", func(t *testing.T) {
+		server := journalTestServer(t, "delete example.com 1")
+		p := journalTestProvider(t, server)
+
+		err := applyChangesToZone(context.TODO(), &plan.Changes{
+			Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+		}, p, "example.com")
+		assert.ErrorContains(t, err, "unable to delete records")
+		assert.NotContains(t, err.Error(), "rolled back")
+		assert.Equal(t, []string{"delete example.com 1"}, server.MutationLog())
+	})
+
+	t.Run("lost answer of a delete", func(t *testing.T) {
+		server := journalTestServer(t)
+		server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs("delete example.com 1"), StatusCode: http.StatusGatewayTimeout, Applied: true})
+		p := journalTestProvider(t, server, WithRetries(1, time.Millisecond, time.Millisecond))
+
+		// the retry finds the record deleted, nothing is rolled back
+		err := applyChangesToZone(context.TODO(), &plan.Changes{
+			Delete: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+		}, p, "example.com")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"delete example.com 1", "delete example.com 1"}, server.MutationLog())
+		assert.Len(t, server.Records("example.com"), 2)
+	})
+}
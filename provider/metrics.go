@@ -0,0 +1,61 @@
+package porkbun
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "external_dns_porkbun"
+
+var protectedChangesRefused = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "protected_changes_refused_total",
+		Help:      "Number of record changes refused because the record is protected.",
+	},
+	[]string{"zone", "action", "type"},
+)
+
+var zoneRollbacks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "zone_rollbacks_total",
+		Help:      "Number of rollbacks of the changes to a zone after a failed apply, by whether all changes were undone.",
+	},
+	[]string{"zone", "result"},
+)
+
+var apiRetries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_retries_total",
+		Help:      "Number of retried Porkbun API calls, by operation and reason.",
+	},
+	[]string{"operation", "reason"},
+)
+
+var apiRetriesExhausted = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_retries_exhausted_total",
+		Help:      "Number of Porkbun API calls that still failed after all retries, by operation.",
+	},
+	[]string{"operation"},
+)
+
+var apiRateLimitWait = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "api_rate_limit_wait_seconds",
+		Help:      "Time Porkbun API calls waited for the client-side rate limiter, by operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 2, 12),
+	},
+	[]string{"operation"},
+)
+
+func init() {
+	prometheus.MustRegister(protectedChangesRefused)
+	prometheus.MustRegister(zoneRollbacks)
+	prometheus.MustRegister(apiRetries)
+	prometheus.MustRegister(apiRetriesExhausted)
+	prometheus.MustRegister(apiRateLimitWait)
+}
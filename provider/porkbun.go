@@ -3,25 +3,235 @@ package porkbun
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/url"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/dnsname"
 	pb "github.com/nrdcg/porkbun"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 
 	"sigs.k8s.io/external-dns/endpoint"
 	"sigs.k8s.io/external-dns/plan"
 	"sigs.k8s.io/external-dns/provider"
 )
 
+const (
+	// porkbunMinTTL is the lowest TTL Porkbun accepts, lower TTLs are raised to it.
+	porkbunMinTTL = 600
+
+	// recordTypeCAA is the CAA record type, which external-dns has no constant for.
+	recordTypeCAA = "CAA"
+	// recordTypeALIAS is Porkbun's ALIAS record type, reported to external-dns as CNAME.
+	recordTypeALIAS = "ALIAS"
+
+	// providerSpecificPriority is the provider-specific property carrying the priority
+	// of an MX record whose target does not include one.
+	providerSpecificPriority = "porkbun/priority"
+	// providerSpecificAlias is the provider-specific property requesting that a CNAME
+	// endpoint is written as an ALIAS record.
+	providerSpecificAlias = "porkbun/alias"
+)
+
+// ApplyOrder is the order in which the record changes of a zone are sent to Porkbun.
+type ApplyOrder string
+
+const (
+	// ApplyOrderDeleteFirst deletes records before creating and updating records.
+	ApplyOrderDeleteFirst ApplyOrder = "delete-first"
+	// ApplyOrderCreateFirst creates and updates records before deleting the records
+	// they replace, so that a name keeps resolving while its records are replaced.
+	// Records that cannot coexist with the created records, i.e. CNAME and ALIAS
+	// records and the records at names that get a CNAME or ALIAS record, are still
+	// deleted first.
+	ApplyOrderCreateFirst ApplyOrder = "create-first"
+)
+
+// supportedRecordTypes are the record types external-dns can manage on Porkbun.
+var supportedRecordTypes = map[string]bool{
+	endpoint.RecordTypeA:     true,
+	endpoint.RecordTypeAAAA:  true,
+	endpoint.RecordTypeCNAME: true,
+	endpoint.RecordTypeTXT:   true,
+	endpoint.RecordTypeNS:    true,
+	endpoint.RecordTypeMX:    true,
+	endpoint.RecordTypeSRV:   true,
+	recordTypeCAA:            true,
+	recordTypeALIAS:          true,
+}
+
 // PorkbunProvider is an implementation of Provider for porkbun DNS.
 type PorkbunProvider struct {
 	provider.BaseProvider
-	client       *pb.Client
+	client       Client
+	baseURL      string
 	domainFilter endpoint.DomainFilter
 	dryRun       bool
 	logger       *slog.Logger
+	aliasRecords bool
+	config       *Config
+
+	protectedRecords    []string
+	protectionRules     []protectionRule
+	zoneProtectionRules map[string][]protectionRule
+
+	managedTypes       []string
+	managedRecordTypes map[string]bool
+
+	applyOrder        ApplyOrder
+	zoneConcurrency   int
+	recordConcurrency int
+	recordCallLimit   int
+	recordCalls       *semaphore.Weighted
+
+	retryPolicy retryPolicy
+	rateLimiter *rate.Limiter
+
+	httpClientConfig *HTTPClientConfig
+
+	excludeDomains       []string
+	regexDomainFilter    *regexp.Regexp
+	regexDomainExclusion *regexp.Regexp
+
+	zoneDiscovery       bool
+	zoneRefreshInterval time.Duration
+	listDomains         func(ctx context.Context) ([]string, error)
+	zonesMu             sync.Mutex
+	discoveredZones     []string
+	zonesRefreshedAt    time.Time
+}
+
+// Option configures optional behaviour of the PorkbunProvider.
+type Option func(*PorkbunProvider)
+
+// WithAliasRecords enables writing apex CNAME endpoints and CNAME endpoints with the
+// porkbun/alias=true property as Porkbun ALIAS records. ALIAS records are reported
+// back as CNAME endpoints.
+func WithAliasRecords(enabled bool) Option {
+	return func(p *PorkbunProvider) {
+		p.aliasRecords = enabled
+	}
+}
+
+// WithConfig applies the per-zone settings of a configuration file.
+func WithConfig(config *Config) Option {
+	return func(p *PorkbunProvider) {
+		p.config = config
+	}
+}
+
+// WithProtectedRecords refuses all changes to records matching one of the rules, which
+// have the form "<name pattern> [<type>]" with a glob pattern for the record name
+// relative to the zone, e.g. "@ MX" or "_dmarc TXT".
+func WithProtectedRecords(rules []string) Option {
+	return func(p *PorkbunProvider) {
+		p.protectedRecords = rules
+	}
+}
+
+// WithManagedRecordTypes limits the records the provider reports and changes to the
+// given record types, records of other types are left to be managed by hand. All
+// supported record types are managed if types is empty.
+func WithManagedRecordTypes(types []string) Option {
+	return func(p *PorkbunProvider) {
+		p.managedTypes = types
+	}
+}
+
+// WithApplyOrder sets the order in which the record changes of a zone are sent to
+// Porkbun, ApplyOrderDeleteFirst if order is empty.
+func WithApplyOrder(order ApplyOrder) Option {
+	return func(p *PorkbunProvider) {
+		p.applyOrder = order
+	}
+}
+
+// WithConcurrency sets how many zones are changed at the same time and how many
+// record changes are sent to Porkbun at the same time for each of these zones. Both
+// default to one.
+func WithConcurrency(zones int, recordsPerZone int) Option {
+	return func(p *PorkbunProvider) {
+		p.zoneConcurrency = zones
+		p.recordConcurrency = recordsPerZone
+	}
+}
+
+// WithGlobalConcurrency caps how many record changes are sent to Porkbun at the same
+// time across all zones being changed, so the cap can be lower than the product of
+// the limits of WithConcurrency. Zero, the default, sets no cap.
+func WithGlobalConcurrency(records int) Option {
+	return func(p *PorkbunProvider) {
+		p.recordCallLimit = records
+	}
+}
+
+// WithRetries sets how often failed Porkbun API calls are retried when the error is
+// transient, e.g. rate limiting or a server error. The delay before a retry starts
+// at baseDelay and doubles with every retry up to maxDelay.
+func WithRetries(maxRetries int, baseDelay time.Duration, maxDelay time.Duration) Option {
+	return func(p *PorkbunProvider) {
+		p.retryPolicy = retryPolicy{maxRetries: maxRetries, baseDelay: baseDelay, maxDelay: maxDelay}
+	}
+}
+
+// WithRateLimit limits the calls to the Porkbun API to callsPerSecond on average with
+// bursts of up to burst calls. All calls of the provider share the limit, whether
+// they are made for reading records, changing records or concurrently. The calls are
+// not limited if callsPerSecond is zero.
+func WithRateLimit(callsPerSecond float64, burst int) Option {
+	return func(p *PorkbunProvider) {
+		p.rateLimiter = nil
+		if callsPerSecond != 0 {
+			p.rateLimiter = rate.NewLimiter(rate.Limit(callsPerSecond), burst)
+		}
+	}
+}
+
+// WithClient replaces the Porkbun API client created from the API key and password.
+// Zone discovery requires the client to have a ListDomains(ctx context.Context)
+// ([]string, error) method, which is used instead of listing the domains through the
+// Porkbun API.
+func WithClient(client Client) Option {
+	return func(p *PorkbunProvider) {
+		p.client = client
+	}
+}
+
+// WithBaseURL points the Porkbun API client at another base URL than
+// https://api.porkbun.com/api/json/v3/, e.g. at a staging stand-in or at a fake of the
+// API in tests. It has no effect on a client passed with WithClient.
+func WithBaseURL(baseURL string) Option {
+	return func(p *PorkbunProvider) {
+		p.baseURL = baseURL
+	}
+}
+
+// WithDomainExclusions excludes domains and their subdomains from the domain filter.
+func WithDomainExclusions(excludeDomains []string) Option {
+	return func(p *PorkbunProvider) {
+		p.excludeDomains = excludeDomains
+	}
+}
+
+// WithRegexDomainFilter matches domains against regular expressions instead of the
+// domain filter list. The domain filter list still names the zones unless zone
+// discovery is enabled. A match of regexDomainExclusion excludes a domain. Either
+// expression may be nil.
+func WithRegexDomainFilter(regexDomainFilter *regexp.Regexp, regexDomainExclusion *regexp.Regexp) Option {
+	return func(p *PorkbunProvider) {
+		p.regexDomainFilter = regexDomainFilter
+		p.regexDomainExclusion = regexDomainExclusion
+	}
 }
 
 // PorkbunChange includes the changesets that need to be applied to the porkbun API
@@ -32,16 +242,10 @@ type PorkbunChange struct {
 }
 
 // NewPorkbunProvider creates a new provider including the porkbun API client
-func NewPorkbunProvider(domainFilterList []string, apiKey string, apiSecret string, dryRun bool, logger *slog.Logger) (*PorkbunProvider, error) {
+func NewPorkbunProvider(domainFilterList []string, apiKey string, apiSecret string, dryRun bool, logger *slog.Logger, opts ...Option) (*PorkbunProvider, error) {
 	if logger == nil {
 		return nil, fmt.Errorf("porkbun provider requires a non-nil logger")
 	}
-	domainFilter := endpoint.NewDomainFilter(domainFilterList)
-
-	if !domainFilter.IsConfigured() {
-		return nil, fmt.Errorf("porkbun provider requires at least one configured domain in the domainFilter")
-	}
-
 	if apiKey == "" {
 		return nil, fmt.Errorf("porkbun provider requires an API Key")
 	}
@@ -54,51 +258,337 @@ func NewPorkbunProvider(domainFilterList []string, apiKey string, apiSecret stri
 
 	client := pb.New(apiSecret, apiKey)
 
-	return &PorkbunProvider{
-		client:       client,
-		domainFilter: *domainFilter,
-		dryRun:       dryRun,
-		logger:       logger,
-	}, nil
+	p := &PorkbunProvider{
+		client:     client,
+		dryRun:     dryRun,
+		logger:     logger,
+		applyOrder: ApplyOrderDeleteFirst,
+
+		zoneConcurrency:   1,
+		recordConcurrency: 1,
+		retryPolicy:       defaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.baseURL != "" {
+		baseURL, err := url.Parse(p.baseURL)
+		if err != nil || baseURL.Scheme == "" || baseURL.Host == "" {
+			return nil, fmt.Errorf("invalid Porkbun API base URL %q", p.baseURL)
+		}
+		client.BaseURL = baseURL
+	}
+
+	if p.httpClientConfig != nil {
+		httpClient, err := newHTTPClient(*p.httpClientConfig)
+		if err != nil {
+			return nil, err
+		}
+		client.HTTPClient = httpClient
+	}
+
+	if p.client == nil {
+		return nil, fmt.Errorf("porkbun provider requires a non-nil client")
+	}
+	if lister, ok := p.client.(domainLister); ok {
+		p.listDomains = lister.ListDomains
+	} else if p.client == Client(client) {
+		p.listDomains = func(ctx context.Context) ([]string, error) {
+			return listDomains(ctx, client, apiKey, apiSecret)
+		}
+	} else if p.zoneDiscovery {
+		// Listing the domains with the API key and password would bypass the client.
+		return nil, fmt.Errorf("zone discovery requires a client with a ListDomains method")
+	}
+
+	p.domainFilter = *p.newDomainFilter(domainFilterList)
+
+	if !p.zoneDiscovery && len(p.domainFilter.Filters) == 0 {
+		return nil, fmt.Errorf("porkbun provider requires at least one configured domain in the domainFilter")
+	}
+
+	rules, err := parseProtectionRules(p.protectedRecords)
+	if err != nil {
+		return nil, err
+	}
+	p.protectionRules = rules
+
+	if p.config != nil {
+		p.zoneProtectionRules = make(map[string][]protectionRule, len(p.config.Zones))
+		for name, zone := range p.config.Zones {
+			rules, err := parseProtectionRules(zone.ProtectedRecords)
+			if err != nil {
+				return nil, fmt.Errorf("zone %s: %w", name, err)
+			}
+			p.zoneProtectionRules[dnsname.Normalize(name)] = rules
+		}
+	}
+
+	if len(p.managedTypes) > 0 {
+		p.managedRecordTypes = make(map[string]bool, len(p.managedTypes))
+		for _, recordType := range p.managedTypes {
+			recordType = strings.ToUpper(strings.TrimSpace(recordType))
+			if !supportedRecordTypes[recordType] {
+				return nil, fmt.Errorf("managed record type %s is not supported", recordType)
+			}
+			p.managedRecordTypes[recordType] = true
+		}
+	}
+
+	switch p.applyOrder {
+	case "":
+		p.applyOrder = ApplyOrderDeleteFirst
+	case ApplyOrderDeleteFirst, ApplyOrderCreateFirst:
+	default:
+		return nil, fmt.Errorf("unknown apply order %q, expected %s or %s", p.applyOrder, ApplyOrderDeleteFirst, ApplyOrderCreateFirst)
+	}
+
+	if p.zoneConcurrency < 1 || p.recordConcurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d zones and %d records per zone", p.zoneConcurrency, p.recordConcurrency)
+	}
+	if p.recordCallLimit < 0 {
+		return nil, fmt.Errorf("global concurrency must not be negative, got %d records", p.recordCallLimit)
+	}
+	if p.recordCallLimit > 0 {
+		p.recordCalls = semaphore.NewWeighted(int64(p.recordCallLimit))
+	}
+
+	if p.retryPolicy.maxRetries < 0 || p.retryPolicy.baseDelay < 0 || p.retryPolicy.maxDelay < p.retryPolicy.baseDelay {
+		return nil, fmt.Errorf("invalid retries, got %d retries with delays from %s to %s", p.retryPolicy.maxRetries, p.retryPolicy.baseDelay, p.retryPolicy.maxDelay)
+	}
+
+	if p.rateLimiter != nil && (p.rateLimiter.Limit() < 0 || p.rateLimiter.Burst() < 1) {
+		return nil, fmt.Errorf("invalid rate limit, got %v calls per second with bursts of %d", float64(p.rateLimiter.Limit()), p.rateLimiter.Burst())
+	}
+
+	return p, nil
 }
 
 func (p *PorkbunProvider) DeleteDnsRecords(ctx context.Context, zone string, records []pb.Record) error {
-	for _, record := range records {
+	return p.deleteRecords(ctx, zone, records, nil)
+}
+
+func (p *PorkbunProvider) CreateDnsRecords(ctx context.Context, zone string, records []pb.Record) error {
+	return p.createRecords(ctx, zone, records, nil)
+}
+
+func (p *PorkbunProvider) UpdateDnsRecords(ctx context.Context, zone string, records []pb.Record) error {
+	return p.updateRecords(ctx, zone, records, nil)
+}
+
+// deleteRecords deletes the records and adds every deletion to the journal.
+func (p *PorkbunProvider) deleteRecords(ctx context.Context, zone string, records []pb.Record, journal *zoneJournal) error {
+	return p.forEachRecord(ctx, records, func(record pb.Record) error {
 		id, err := strconv.Atoi(record.ID)
 		if err != nil {
 			return fmt.Errorf("unable to parse record ID '%s': %w. Full record: %+v", record.ID, err, record)
 		}
-		err = p.client.DeleteRecord(ctx, zone, id)
+		err = p.deleteRecord(ctx, zone, id)
 		if err != nil {
 			return fmt.Errorf("unable to delete record: %w", err)
 		}
-	}
-	return nil
+		journal.deleted(record)
+		return nil
+	})
 }
 
-func (p *PorkbunProvider) CreateDnsRecords(ctx context.Context, zone string, records []pb.Record) error {
-	for _, record := range records {
-		_, err := p.client.CreateRecord(ctx, zone, record)
+// createRecords creates the records and adds every creation to the journal.
+func (p *PorkbunProvider) createRecords(ctx context.Context, zone string, records []pb.Record, journal *zoneJournal) error {
+	return p.forEachRecord(ctx, records, func(record pb.Record) error {
+		id, err := p.createRecord(ctx, zone, record)
 		if err != nil {
 			return fmt.Errorf("unable to create record: %w", err)
 		}
-	}
-	return nil
+		journal.created(id, record)
+		return nil
+	})
 }
 
-func (p *PorkbunProvider) UpdateDnsRecords(ctx context.Context, zone string, records []pb.Record) error {
-	for _, record := range records {
+// updateRecords edits the records and adds every edit to the journal.
+func (p *PorkbunProvider) updateRecords(ctx context.Context, zone string, records []pb.Record, journal *zoneJournal) error {
+	return p.forEachRecord(ctx, records, func(record pb.Record) error {
 		id, err := strconv.Atoi(record.ID)
 		if err != nil {
 			return fmt.Errorf("unable to parse record ID '%s': %w. Full record: %+v", record.ID, err, record)
 		}
-		err = p.client.EditRecord(ctx, zone, id, record)
+		err = p.editRecord(ctx, zone, id, record)
 		if err != nil {
 			j, _ := json.MarshalIndent(record, "", "  ")
 			return fmt.Errorf("unable to update record %s with id %d at zone %s: %w", j, id, zone, err)
 		}
+		journal.updated(id)
+		return nil
+	})
+}
+
+// forEachRecord calls fn for the records, at most recordConcurrency calls at a time
+// and, with a global cap, only while fewer calls than the cap are made for all zones.
+// No further calls are started once a call failed, the errors of all failed calls
+// are returned joined.
+func (p *PorkbunProvider) forEachRecord(ctx context.Context, records []pb.Record, fn func(record pb.Record) error) error {
+	var (
+		g      errgroup.Group
+		mu     sync.Mutex
+		errs   []error
+		failed atomic.Bool
+	)
+	g.SetLimit(p.recordConcurrency)
+
+	fail := func(err error) {
+		failed.Store(true)
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
 	}
-	return nil
+
+	for _, record := range records {
+		if failed.Load() {
+			break
+		}
+		g.Go(func() error {
+			// Go waits for a free slot, a call may have failed in the meantime.
+			if failed.Load() {
+				return nil
+			}
+			if p.recordCalls != nil {
+				if err := p.recordCalls.Acquire(ctx, 1); err != nil {
+					fail(err)
+					return nil
+				}
+				defer p.recordCalls.Release(1)
+			}
+			if err := fn(record); err != nil {
+				fail(err)
+			}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// newDomainFilter builds the domain filter from the domain filter list and the
+// exclusion options.
+func (p *PorkbunProvider) newDomainFilter(domainFilterList []string) *endpoint.DomainFilter {
+	if p.regexDomainFilter != nil || p.regexDomainExclusion != nil {
+		// The regular expressions take precedence when matching, the plain filters
+		// are kept to name the zones.
+		domainFilter := endpoint.NewRegexDomainFilter(p.regexDomainFilter, p.regexDomainExclusion)
+		domainFilter.Filters = endpoint.NewDomainFilter(domainFilterList).Filters
+		return domainFilter
+	}
+	return endpoint.NewDomainFilterWithExclusions(domainFilterList, p.excludeDomains)
+}
+
+// GetDomainFilter returns the domain filter the provider was created with, so that
+// external-dns learns about it during the webhook negotiation. It returns a copy, as
+// serializing a domain filter sorts its lists in place while the provider reads them.
+func (p *PorkbunProvider) GetDomainFilter() endpoint.DomainFilterInterface {
+	return p.newDomainFilter(p.domainFilter.Filters)
+}
+
+// AdjustEndpoints normalizes the desired endpoints to what Porkbun can store and to the
+// form Records reports them in, so that external-dns does not plan updates that never
+// converge. Unsupported record types are dropped, set identifiers are removed, TTLs are
+// raised to Porkbun's minimum and names and targets are normalized.
+func (p *PorkbunProvider) AdjustEndpoints(endpoints []*endpoint.Endpoint) ([]*endpoint.Endpoint, error) {
+	type endpointKey struct {
+		name       string
+		recordType string
+	}
+
+	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	merged := make(map[endpointKey]*endpoint.Endpoint)
+
+	for _, ep := range endpoints {
+		ep.RecordType = strings.ToUpper(ep.RecordType)
+		if !supportedRecordTypes[ep.RecordType] {
+			p.logger.Warn("record type is not supported by Porkbun, dropping endpoint", "dnsName", ep.DNSName, "type", ep.RecordType)
+			continue
+		}
+
+		if !p.managesType(ep.RecordType) {
+			p.logger.Debug("record type is not managed, dropping endpoint", "dnsName", ep.DNSName, "type", ep.RecordType)
+			continue
+		}
+
+		ep.DNSName = dnsname.Normalize(ep.DNSName)
+
+		if ep.SetIdentifier != "" {
+			p.logger.Warn("Porkbun does not support routing policies, removing set identifier", "dnsName", ep.DNSName, "type", ep.RecordType, "setIdentifier", ep.SetIdentifier)
+			ep.SetIdentifier = ""
+		}
+
+		zoneConfig := p.config.Zone(endpointZoneName(ep, p.knownZones()))
+		if !zoneConfig.allowsType(ep.RecordType) {
+			p.logger.Warn("record type is not allowed in the zone, dropping endpoint", "dnsName", ep.DNSName, "type", ep.RecordType)
+			continue
+		}
+
+		if ttl := zoneConfig.ttl(ep.RecordTTL); ttl != ep.RecordTTL {
+			p.logger.Debug("applying the zone TTL settings", "dnsName", ep.DNSName, "type", ep.RecordType, "ttl", ep.RecordTTL, "zoneTTL", ttl)
+			ep.RecordTTL = ttl
+		}
+
+		if len(ep.Targets) > 0 {
+			targets := make(endpoint.Targets, 0, len(ep.Targets))
+			for _, target := range ep.Targets {
+				content, prio, err := porkbunContent(ep, target)
+				if err != nil {
+					p.logger.Warn("invalid target, dropping it", "dnsName", ep.DNSName, "type", ep.RecordType, "target", target, "error", err)
+					continue
+				}
+				targets = append(targets, endpointTarget(pb.Record{Type: ep.RecordType, Content: content, Prio: prio}))
+			}
+			if len(targets) == 0 {
+				p.logger.Warn("endpoint has no valid targets, dropping endpoint", "dnsName", ep.DNSName, "type", ep.RecordType)
+				continue
+			}
+			ep.Targets = targets
+		}
+
+		// The priority is part of the targets now and Records only reports the alias
+		// property for ALIAS records below the zone apex.
+		ep.DeleteProviderSpecificProperty(providerSpecificPriority)
+		if alias, ok := ep.GetProviderSpecificProperty(providerSpecificAlias); ok {
+			if !p.aliasRecords || alias != "true" || ep.RecordType != endpoint.RecordTypeCNAME || p.isZoneApex(ep.DNSName) {
+				ep.DeleteProviderSpecificProperty(providerSpecificAlias)
+			}
+		}
+
+		key := endpointKey{name: ep.DNSName, recordType: ep.RecordType}
+		if existing, ok := merged[key]; ok {
+			p.logger.Debug("merging endpoints with the same name and type", "dnsName", ep.DNSName, "type", ep.RecordType)
+			existing.Targets = append(existing.Targets, ep.Targets...)
+			existing.UniqueOrderedTargets()
+			if ep.RecordTTL.IsConfigured() && (!existing.RecordTTL.IsConfigured() || ep.RecordTTL < existing.RecordTTL) {
+				existing.RecordTTL = ep.RecordTTL
+			}
+			continue
+		}
+
+		merged[key] = ep
+		adjusted = append(adjusted, ep)
+	}
+
+	return adjusted, nil
+}
+
+// managesType reports whether the provider manages records of the type.
+func (p *PorkbunProvider) managesType(recordType string) bool {
+	return p.managedRecordTypes == nil || p.managedRecordTypes[recordType]
+}
+
+// isZoneApex reports whether name is the apex of one of the configured zones.
+func (p *PorkbunProvider) isZoneApex(name string) bool {
+	for _, zone := range p.knownZones() {
+		if dnsname.Normalize(zone) == dnsname.Normalize(name) {
+			return true
+		}
+	}
+	return false
 }
 
 // Records delivers the list of Endpoint records for all zones.
@@ -113,26 +603,25 @@ func (p *PorkbunProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, er
 			return nil, err
 		}
 
-		for _, domain := range p.domainFilter.Filters {
+		zones, err := p.zones(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, domain := range zones {
 
-			records, err := p.client.RetrieveRecords(ctx, domain)
+			records, err := p.retrieveRecords(ctx, domain)
 			if err != nil {
 				p.logger.Error("unable to query DNS zone records", "domain", domain, "error", err)
 				continue
 			}
 			p.logger.Info("got DNS records for domain", "domain", domain)
-			for _, rec := range records {
-				name := rec.Name
-				nameStart := strings.Split(rec.Name, ".")[0]
-				if nameStart == "@" {
-					name = domain
-				}
-				ttl, err := strconv.Atoi(rec.TTL)
-				if err != nil {
-					p.logger.Warn("unable to parse TTL, using default", "ttl", rec.TTL, "error", err)
-					ttl = 600
+			for _, ep := range recordsToEndpoints(p.logger, domain, records, p.aliasRecords) {
+				// A zone may be shared with records outside of the filtered subtree
+				// or with records of types that are managed by hand.
+				if !p.domainFilter.Match(ep.DNSName) || !p.managesType(ep.RecordType) {
+					continue
 				}
-				ep := endpoint.NewEndpointWithTTL(name, rec.Type, endpoint.TTL(ttl), rec.Content)
 				endpoints = append(endpoints, ep)
 			}
 		}
@@ -143,6 +632,56 @@ func (p *PorkbunProvider) Records(ctx context.Context) ([]*endpoint.Endpoint, er
 	return endpoints, nil
 }
 
+// recordsToEndpoints groups the Porkbun records of a zone by name and type into
+// one endpoint per group carrying all targets. If the records of a group disagree
+// on their TTL, the lowest TTL is reported so that a differing desired TTL is
+// written to every record of the group on the next update. With aliasAsCNAME set,
+// ALIAS records are reported as CNAME endpoints, marked with the porkbun/alias
+// property unless they are at the zone apex.
+func recordsToEndpoints(logger *slog.Logger, domain string, records []pb.Record, aliasAsCNAME bool) []*endpoint.Endpoint {
+	type recordKey struct {
+		name       string
+		recordType string
+	}
+
+	endpoints := make([]*endpoint.Endpoint, 0, len(records))
+	grouped := make(map[recordKey]*endpoint.Endpoint)
+	zone := dnsname.Normalize(domain)
+
+	for _, rec := range records {
+		name := dnsname.FromPorkbun(rec.Name, zone)
+		ttl, err := strconv.Atoi(rec.TTL)
+		if err != nil {
+			logger.Warn("unable to parse TTL, using default", "ttl", rec.TTL, "error", err)
+			ttl = porkbunMinTTL
+		}
+
+		recordType := rec.Type
+		if aliasAsCNAME && recordType == recordTypeALIAS {
+			recordType = endpoint.RecordTypeCNAME
+		}
+
+		target := endpointTarget(rec)
+		key := recordKey{name: name, recordType: recordType}
+		if ep, ok := grouped[key]; ok {
+			ep.Targets = append(ep.Targets, target)
+			if endpoint.TTL(ttl) != ep.RecordTTL {
+				logger.Warn("records disagree on TTL, using the lowest", "name", name, "type", recordType, "ttl", ep.RecordTTL, "otherTTL", ttl)
+				ep.RecordTTL = min(ep.RecordTTL, endpoint.TTL(ttl))
+			}
+			continue
+		}
+
+		ep := endpoint.NewEndpointWithTTL(name, recordType, endpoint.TTL(ttl), target)
+		if recordType != rec.Type && name != zone {
+			ep.SetProviderSpecificProperty(providerSpecificAlias, "true")
+		}
+		grouped[key] = ep
+		endpoints = append(endpoints, ep)
+	}
+	return endpoints
+}
+
 // ApplyChanges applies a given set of changes in a given zone.
 func (p *PorkbunProvider) ApplyChanges(ctx context.Context, changes *plan.Changes) error {
 	if !changes.HasChanges() {
@@ -158,20 +697,28 @@ func (p *PorkbunProvider) ApplyChanges(ctx context.Context, changes *plan.Change
 			return err
 		}
 	}
+	zones, err := p.zones(ctx)
+	if err != nil {
+		return err
+	}
 	perZoneChanges := map[string]*plan.Changes{}
 
-	for _, zoneName := range p.domainFilter.Filters {
+	for _, zoneName := range zones {
 		p.logger.Debug("zone detected", "zone", zoneName)
 
 		perZoneChanges[zoneName] = &plan.Changes{}
 	}
 
 	for _, ep := range changes.Create {
-		zoneName := endpointZoneName(ep, p.domainFilter.Filters)
-		if zoneName == "" {
+		zoneName := endpointZoneName(ep, zones)
+		if zoneName == "" || !p.domainFilter.Match(ep.DNSName) {
 			p.logger.Debug("ignoring change since it did not match any zone", "type", "create", "endpoint", ep)
 			continue
 		}
+		if err := p.checkZonePolicy(zoneName, ep); err != nil {
+			p.logger.Warn("refusing change", "type", "create", "endpoint", ep, "zone", zoneName, "reason", err)
+			continue
+		}
 		p.logger.Debug("planning", "type", "create", "endpoint", ep, "zone", zoneName)
 
 		perZoneChanges[zoneName].Create = append(perZoneChanges[zoneName].Create, ep)
@@ -180,30 +727,42 @@ func (p *PorkbunProvider) ApplyChanges(ctx context.Context, changes *plan.Change
 	// UpdateOld contains the state before the desired update (UpdateNew)
 	// see https://github.com/kubernetes-sigs/external-dns/blob/master/plan/plan.go 232 - 233
 	for _, ep := range changes.UpdateOld {
-		zoneName := endpointZoneName(ep, p.domainFilter.Filters)
-		if zoneName == "" {
+		zoneName := endpointZoneName(ep, zones)
+		if zoneName == "" || !p.domainFilter.Match(ep.DNSName) {
 			p.logger.Debug("ignoring change since it did not match any zone", "type", "updateOld", "endpoint", ep)
 			continue
 		}
+		if err := p.checkZonePolicy(zoneName, ep); err != nil {
+			p.logger.Warn("refusing change", "type", "updateOld", "endpoint", ep, "zone", zoneName, "reason", err)
+			continue
+		}
 		perZoneChanges[zoneName].UpdateOld = append(perZoneChanges[zoneName].UpdateOld, ep)
 	}
 
 	for _, ep := range changes.UpdateNew {
-		zoneName := endpointZoneName(ep, p.domainFilter.Filters)
-		if zoneName == "" {
+		zoneName := endpointZoneName(ep, zones)
+		if zoneName == "" || !p.domainFilter.Match(ep.DNSName) {
 			p.logger.Debug("ignoring change since it did not match any zone", "type", "updateNew", "endpoint", ep)
 			continue
 		}
+		if err := p.checkZonePolicy(zoneName, ep); err != nil {
+			p.logger.Warn("refusing change", "type", "updateNew", "endpoint", ep, "zone", zoneName, "reason", err)
+			continue
+		}
 		p.logger.Debug("planning", "type", "updateNew", "endpoint", ep, "zone", zoneName)
 		perZoneChanges[zoneName].UpdateNew = append(perZoneChanges[zoneName].UpdateNew, ep)
 	}
 
 	for _, ep := range changes.Delete {
-		zoneName := endpointZoneName(ep, p.domainFilter.Filters)
-		if zoneName == "" {
+		zoneName := endpointZoneName(ep, zones)
+		if zoneName == "" || !p.domainFilter.Match(ep.DNSName) {
 			p.logger.Debug("ignoring change since it did not match any zone", "type", "delete", "endpoint", ep)
 			continue
 		}
+		if err := p.checkZonePolicy(zoneName, ep); err != nil {
+			p.logger.Warn("refusing change", "type", "delete", "endpoint", ep, "zone", zoneName, "reason", err)
+			continue
+		}
 		p.logger.Debug("planning", "type", "delete", "endpoint", ep, "zone", zoneName)
 		perZoneChanges[zoneName].Delete = append(perZoneChanges[zoneName].Delete, ep)
 	}
@@ -213,26 +772,51 @@ func (p *PorkbunProvider) ApplyChanges(ctx context.Context, changes *plan.Change
 		return nil
 	}
 
-	var firstErr error
+	var (
+		g    errgroup.Group
+		mu   sync.Mutex
+		errs []error
+	)
+	g.SetLimit(p.zoneConcurrency)
 
-	// Assemble changes per zone and prepare it for the porkbun API client
+	// Zones are independent of each other, so they are changed concurrently and a
+	// failing zone does not keep the others from being changed.
 	for zoneName, c := range perZoneChanges {
 		if !c.HasChanges() {
 			continue
 		}
-		err := applyChangesToZone(ctx, c, p, zoneName)
-		if err != nil {
-			p.logger.Error("unable to apply changes to zone, skipping", "zone", zoneName, "error", err.Error())
-			if firstErr == nil {
-				firstErr = err
+		g.Go(func() error {
+			err := applyChangesToZone(ctx, c, p, zoneName)
+			if err != nil {
+				p.logger.Error("unable to apply changes to zone, skipping", "zone", zoneName, "error", err.Error())
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("zone %s: %w", zoneName, err))
+				mu.Unlock()
 			}
-			continue
-		}
+			return nil
+		})
 	}
+	_ = g.Wait()
 
 	p.logger.Debug("update(s) completed")
 
-	return firstErr
+	return errors.Join(errs...)
+}
+
+// checkZonePolicy returns why the managed record types or the configuration of the
+// zone refuse changes to the endpoint, or nil if the endpoint may be changed.
+func (p *PorkbunProvider) checkZonePolicy(zone string, ep *endpoint.Endpoint) error {
+	if !p.managesType(ep.RecordType) {
+		return fmt.Errorf("record type %s is not managed", ep.RecordType)
+	}
+	zoneConfig := p.config.Zone(zone)
+	if zoneConfig.ReadOnly {
+		return fmt.Errorf("zone %s is read-only", zone)
+	}
+	if !zoneConfig.allowsType(ep.RecordType) {
+		return fmt.Errorf("record type %s is not allowed in zone %s", ep.RecordType, zone)
+	}
+	return nil
 }
 
 func applyChangesToZone(ctx context.Context, c *plan.Changes, p *PorkbunProvider, zone string) error {
@@ -242,45 +826,157 @@ func applyChangesToZone(ctx context.Context, c *plan.Changes, p *PorkbunProvider
 	}
 
 	// Gather records from API to extract the record ID which is necessary for updating/deleting the record
-	recs, err := p.client.RetrieveRecords(ctx, zone)
+	recs, err := p.retrieveRecords(ctx, zone)
 	if err != nil {
 		return fmt.Errorf("unable to get DNS records: %w", err)
 	}
+	for i := range recs {
+		recs[i].Name = dnsname.FromPorkbun(recs[i].Name, zone)
+	}
+
+	create, updateOld, updateNew, del := c.Create, c.UpdateOld, c.UpdateNew, c.Delete
+	if p.aliasRecords {
+		create = aliasEndpoints(create, zone)
+		updateOld = aliasEndpoints(updateOld, zone)
+		updateNew = aliasEndpoints(updateNew, zone)
+		del = aliasEndpoints(del, zone)
+	}
+
+	// Endpoints that did not pass through AdjustEndpoints still get the TTL settings
+	// of the zone.
+	create = p.withZoneTTLs(zone, create)
+	updateNew = p.withZoneTTLs(zone, updateNew)
+
+	updateCreate, updateEdit, updateDelete := diffUpdatedRecords(p.logger, recs, updateOld, updateNew, zone)
 
 	change := &PorkbunChange{
-		Create:             convertToPorkbunRecord(p.logger, recs, c.Create, zone, false),
-		DesiredAfterUpdate: convertToPorkbunRecord(p.logger, recs, c.UpdateNew, zone, false),
-		Delete:             convertToPorkbunRecord(p.logger, recs, c.Delete, zone, true),
+		Create:             append(convertToPorkbunRecord(p.logger, recs, create, zone, false), updateCreate...),
+		DesiredAfterUpdate: updateEdit,
+		Delete:             append(convertToPorkbunRecord(p.logger, recs, del, zone, true), updateDelete...),
+	}
+
+	// Protected records are refused here, on the records actually sent to Porkbun,
+	// so that no code path can change them.
+	change.Create = p.refuseProtected(zone, "create", change.Create)
+	change.DesiredAfterUpdate = p.refuseProtected(zone, "update", change.DesiredAfterUpdate)
+	change.Delete = p.refuseProtected(zone, "delete", change.Delete)
+
+	// Every mutation is journaled so that a zone is not left half-changed when a
+	// later mutation fails.
+	journal := newZoneJournal(zone, recs)
+	err = p.applyPorkbunChange(ctx, zone, change, journal)
+	if err != nil {
+		return p.rollback(ctx, journal, err)
+	}
+
+	return nil
+}
+
+// withZoneTTLs returns the endpoints with the default and minimum TTL of the zone
+// applied. Endpoints are copied before they are changed.
+func (p *PorkbunProvider) withZoneTTLs(zone string, endpoints []*endpoint.Endpoint) []*endpoint.Endpoint {
+	zoneConfig := p.config.Zone(zone)
+	adjusted := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ttl := zoneConfig.ttl(ep.RecordTTL); ttl != ep.RecordTTL {
+			p.logger.Debug("applying the zone TTL settings", "dnsName", ep.DNSName, "type", ep.RecordType, "ttl", ep.RecordTTL, "zoneTTL", ttl)
+			ep = ep.DeepCopy()
+			ep.RecordTTL = ttl
+		}
+		adjusted = append(adjusted, ep)
+	}
+	return adjusted
+}
+
+// applyPorkbunChange sends the records of a change to Porkbun in the configured order.
+func (p *PorkbunProvider) applyPorkbunChange(ctx context.Context, zone string, change *PorkbunChange, journal *zoneJournal) error {
+	deleteFirst, deleteLast := change.Delete, []pb.Record(nil)
+	if p.applyOrder == ApplyOrderCreateFirst {
+		deleteFirst, deleteLast = splitConflictingDeletes(change, zone)
 	}
 
-	err = p.DeleteDnsRecords(ctx, zone, change.Delete)
+	err := p.deleteRecords(ctx, zone, deleteFirst, journal)
 	if err != nil {
 		return fmt.Errorf("unable to delete records: %w", err)
 	}
-	err = p.CreateDnsRecords(ctx, zone, change.Create)
+	err = p.createRecords(ctx, zone, change.Create, journal)
 	if err != nil {
 		return fmt.Errorf("unable to create records: %w", err)
 	}
-	err = p.UpdateDnsRecords(ctx, zone, change.DesiredAfterUpdate)
+	err = p.updateRecords(ctx, zone, change.DesiredAfterUpdate, journal)
 	if err != nil {
 		return fmt.Errorf("unable to update records: %w", err)
 	}
-
+	err = p.deleteRecords(ctx, zone, deleteLast, journal)
+	if err != nil {
+		return fmt.Errorf("unable to delete records: %w", err)
+	}
 	return nil
 }
 
+// splitConflictingDeletes splits the deletions of a change into the ones that have to
+// happen before records are created and updated and the ones that can wait until
+// afterwards. A CNAME or ALIAS record cannot share its name with other records, so
+// deleted CNAME and ALIAS records and all deletions at names that get a CNAME or
+// ALIAS record go first.
+func splitConflictingDeletes(change *PorkbunChange, zone string) (first, last []pb.Record) {
+	exclusive := make(map[string]bool)
+	for _, rec := range append(append([]pb.Record(nil), change.Create...), change.DesiredAfterUpdate...) {
+		if isExclusiveType(rec.Type) {
+			exclusive[rec.Name] = true
+		}
+	}
+
+	for _, rec := range change.Delete {
+		name, _ := dnsname.ToPorkbun(dnsname.FromPorkbun(rec.Name, zone), zone)
+		if isExclusiveType(rec.Type) || exclusive[name] {
+			first = append(first, rec)
+			continue
+		}
+		last = append(last, rec)
+	}
+	return first, last
+}
+
+// isExclusiveType reports whether records of the type cannot share their name with
+// other records.
+func isExclusiveType(recordType string) bool {
+	return recordType == endpoint.RecordTypeCNAME || recordType == recordTypeALIAS
+}
+
+// aliasEndpoints returns the endpoints with every CNAME endpoint at the zone apex or
+// with the porkbun/alias=true property turned into an ALIAS endpoint. The given
+// endpoints are not modified.
+func aliasEndpoints(endpoints []*endpoint.Endpoint, zoneName string) []*endpoint.Endpoint {
+	result := make([]*endpoint.Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if ep.RecordType != endpoint.RecordTypeCNAME {
+			result = append(result, ep)
+			continue
+		}
+		alias, _ := ep.GetProviderSpecificProperty(providerSpecificAlias)
+		if dnsname.Normalize(ep.DNSName) != dnsname.Normalize(zoneName) && alias != "true" {
+			result = append(result, ep)
+			continue
+		}
+		aliased := ep.DeepCopy()
+		aliased.RecordType = recordTypeALIAS
+		result = append(result, aliased)
+	}
+	return result
+}
+
 // convertToPorkbunRecord transforms a list of endpoints into a list of Porkbun DNS records.
 func convertToPorkbunRecord(logger *slog.Logger, recs []pb.Record, endpoints []*endpoint.Endpoint, zoneName string, useStrictMatchForDelete bool) []pb.Record {
 	records := make([]pb.Record, 0, len(endpoints))
 
 	for _, ep := range endpoints {
-		fqdn := ep.DNSName
+		fqdn := dnsname.Normalize(ep.DNSName)
 
-		var recordName string
-		if fqdn == zoneName {
-			recordName = ""
-		} else {
-			recordName = strings.TrimSuffix(fqdn, "."+zoneName)
+		recordName, ok := dnsname.ToPorkbun(fqdn, zoneName)
+		if !ok {
+			logger.Warn("endpoint does not belong to zone, skipping", "dnsName", ep.DNSName, "zone", zoneName)
+			continue
 		}
 
 		if len(ep.Targets) == 0 {
@@ -288,38 +984,266 @@ func convertToPorkbunRecord(logger *slog.Logger, recs []pb.Record, endpoints []*
 			continue
 		}
 
-		target := ep.Targets[0]
-		if ep.RecordType == endpoint.RecordTypeTXT && strings.HasPrefix(target, "\"heritage=") {
-			target = strings.Trim(ep.Targets[0], "\"")
-		}
+		for _, target := range ep.Targets {
+			content, prio, err := porkbunContent(ep, target)
+			if err != nil {
+				logger.Warn("unable to convert target, skipping", "dnsName", ep.DNSName, "type", ep.RecordType, "target", target, "error", err)
+				continue
+			}
 
-		var id = getIDforRecord(fqdn, target, ep.RecordType, recs, useStrictMatchForDelete)
+			record := pb.Record{
+				Type:    ep.RecordType,
+				Name:    recordName, // e.g. subsub.sub
+				TTL:     strconv.FormatInt(int64(ep.RecordTTL), 10),
+				Content: content,
+				Prio:    prio,
+			}
+			record.ID = getIDforRecord(fqdn, endpointTarget(record), ep.RecordType, recs, useStrictMatchForDelete) // ID from FQDN-Match
 
-		records = append(records, pb.Record{
-			Type:    ep.RecordType,
-			Name:    recordName, // e.g. subsub.sub
-			TTL:     strconv.FormatInt(int64(ep.RecordTTL), 10),
-			Content: target,
-			ID:      id, // ID from FQDN-Match
-		})
+			records = append(records, record)
+		}
 	}
 	return records
 }
 
-// removeNoopTXTUpdates removes unchanged TXT updates from UpdateNew.
-// UpdateOld is left as-is and is not used in further processing.
+// diffUpdatedRecords works out which individual Porkbun records have to be created,
+// edited or deleted so that the records of each updated endpoint match its full
+// target set. The records being updated are the ones matching the targets of the
+// endpoint's counterpart in oldEndpoints exactly, so that other records at the same
+// name are never touched. Records whose content is still desired are kept and only
+// edited if the TTL changed, surplus records are reused for new targets before new
+// records are created, and whatever remains is deleted.
+func diffUpdatedRecords(logger *slog.Logger, recs []pb.Record, oldEndpoints []*endpoint.Endpoint, endpoints []*endpoint.Endpoint, zoneName string) (create, update, del []pb.Record) {
+	old := make(map[updateKey]*endpoint.Endpoint, len(oldEndpoints))
+	for _, ep := range oldEndpoints {
+		old[newUpdateKey(ep)] = ep
+	}
+
+	for _, ep := range endpoints {
+		desired := convertToPorkbunRecord(logger, nil, []*endpoint.Endpoint{ep}, zoneName, false)
+		if len(desired) == 0 {
+			continue
+		}
+
+		var existing []pb.Record
+		if oldEp, ok := old[newUpdateKey(ep)]; ok {
+			existing = previousRecords(logger, recs, oldEp)
+		} else {
+			logger.Warn("no previous state for updated endpoint, updating all records with its name and type", "dnsName", ep.DNSName, "type", ep.RecordType)
+			for _, rec := range recs {
+				if rec.Type == ep.RecordType && rec.Name == dnsname.Normalize(ep.DNSName) {
+					existing = append(existing, rec)
+				}
+			}
+		}
+
+		claimed := make([]bool, len(existing))
+		pending := make([]pb.Record, 0, len(desired))
+
+		for _, want := range desired {
+			found := false
+			for i, rec := range existing {
+				if claimed[i] || rec.Type != want.Type || endpointTarget(rec) != endpointTarget(want) {
+					continue
+				}
+				claimed[i] = true
+				found = true
+				if ep.RecordTTL.IsConfigured() && rec.TTL != want.TTL {
+					want.ID = rec.ID
+					update = append(update, want)
+				}
+				break
+			}
+			if !found {
+				pending = append(pending, want)
+			}
+		}
+
+		for i, rec := range existing {
+			if claimed[i] {
+				continue
+			}
+			if len(pending) > 0 {
+				want := pending[0]
+				pending = pending[1:]
+				want.ID = rec.ID
+				if !ep.RecordTTL.IsConfigured() {
+					want.TTL = rec.TTL
+				}
+				update = append(update, want)
+				continue
+			}
+			del = append(del, rec)
+		}
+
+		create = append(create, pending...)
+	}
+	return create, update, del
+}
+
+// updateKey pairs the old and new state of an updated endpoint. ALIAS endpoints are
+// keyed as the CNAME endpoints they are reported as, so that switching a CNAME to an
+// ALIAS record and back is an update like any other.
+type updateKey struct {
+	name       string
+	recordType string
+}
+
+func newUpdateKey(ep *endpoint.Endpoint) updateKey {
+	recordType := ep.RecordType
+	if recordType == recordTypeALIAS {
+		recordType = endpoint.RecordTypeCNAME
+	}
+	return updateKey{name: dnsname.Normalize(ep.DNSName), recordType: recordType}
+}
+
+// previousRecords returns the records matching the targets of the old state of an
+// updated endpoint, at most one record per target.
+func previousRecords(logger *slog.Logger, recs []pb.Record, oldEp *endpoint.Endpoint) []pb.Record {
+	name := dnsname.Normalize(oldEp.DNSName)
+	taken := make([]bool, len(recs))
+	previous := make([]pb.Record, 0, len(oldEp.Targets))
+
+	for _, target := range oldEp.Targets {
+		content, prio, err := porkbunContent(oldEp, target)
+		if err != nil {
+			logger.Warn("unable to convert previous target, skipping", "dnsName", oldEp.DNSName, "type", oldEp.RecordType, "target", target, "error", err)
+			continue
+		}
+		oldTarget := endpointTarget(pb.Record{Type: oldEp.RecordType, Content: content, Prio: prio})
+
+		found := false
+		for i, rec := range recs {
+			if taken[i] || rec.Type != oldEp.RecordType || rec.Name != name || endpointTarget(rec) != oldTarget {
+				continue
+			}
+			taken[i] = true
+			found = true
+			previous = append(previous, rec)
+			break
+		}
+		if !found {
+			logger.Debug("previous record not found in zone", "dnsName", oldEp.DNSName, "type", oldEp.RecordType, "target", target)
+		}
+	}
+	return previous
+}
+
+// porkbunContent converts an endpoint target into the content and priority Porkbun
+// stores for the endpoint's record type.
+func porkbunContent(ep *endpoint.Endpoint, target string) (content string, prio string, err error) {
+	switch ep.RecordType {
+	case endpoint.RecordTypeTXT:
+		if strings.HasPrefix(target, "\"heritage=") {
+			target = strings.Trim(target, "\"")
+		}
+		return target, "", nil
+	case endpoint.RecordTypeMX:
+		fields := strings.Fields(target)
+		switch len(fields) {
+		case 1:
+			prio, ok := ep.GetProviderSpecificProperty(providerSpecificPriority)
+			if !ok {
+				return fields[0], "", nil
+			}
+			if _, err := strconv.ParseUint(prio, 10, 16); err != nil {
+				return "", "", fmt.Errorf("invalid %s property '%s': %w", providerSpecificPriority, prio, err)
+			}
+			return fields[0], prio, nil
+		case 2:
+			if _, err := strconv.ParseUint(fields[0], 10, 16); err != nil {
+				return "", "", fmt.Errorf("invalid MX priority '%s': %w", fields[0], err)
+			}
+			return fields[1], fields[0], nil
+		default:
+			return "", "", fmt.Errorf("invalid MX target '%s', expected '<priority> <host>'", target)
+		}
+	case endpoint.RecordTypeSRV:
+		fields := strings.Fields(target)
+		if len(fields) != 4 {
+			return "", "", fmt.Errorf("invalid SRV target '%s', expected '<priority> <weight> <port> <host>'", target)
+		}
+		for i, name := range []string{"priority", "weight", "port"} {
+			if _, err := strconv.ParseUint(fields[i], 10, 16); err != nil {
+				return "", "", fmt.Errorf("invalid SRV %s '%s': %w", name, fields[i], err)
+			}
+		}
+		return strings.Join(fields[1:], " "), fields[0], nil
+	case recordTypeCAA:
+		content, err := normalizeCAA(target)
+		if err != nil {
+			return "", "", err
+		}
+		return content, "", nil
+	default:
+		return target, "", nil
+	}
+}
+
+// normalizeCAA brings a CAA record value into the form '<flags> <tag> "<value>"'
+// with a lower-case tag and a quoted value, regardless of whether the value was
+// quoted before. It is used in both directions so that the targets sent by
+// external-dns and the content returned by Porkbun compare equal.
+func normalizeCAA(value string) (string, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return "", fmt.Errorf("invalid CAA value '%s', expected '<flags> <tag> <value>'", value)
+	}
+
+	flags, err := strconv.ParseUint(fields[0], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid CAA flags '%s': %w", fields[0], err)
+	}
+
+	tag := strings.ToLower(fields[1])
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return "", fmt.Errorf("invalid CAA tag '%s'", fields[1])
+		}
+	}
+
+	// The value is everything after the tag, so whitespace inside it is kept.
+	rest := strings.TrimSpace(value)
+	rest = strings.TrimSpace(rest[len(fields[0]):])
+	rest = strings.TrimSpace(rest[len(fields[1]):])
+	if len(rest) >= 2 && strings.HasPrefix(rest, "\"") && strings.HasSuffix(rest, "\"") {
+		rest = strings.ReplaceAll(rest[1:len(rest)-1], "\\\"", "\"")
+	}
+
+	return fmt.Sprintf("%d %s \"%s\"", flags, tag, strings.ReplaceAll(rest, "\"", "\\\"")), nil
+}
+
+// endpointTarget converts the content and priority of a Porkbun record back into
+// the target external-dns uses for the record type.
+func endpointTarget(rec pb.Record) string {
+	switch rec.Type {
+	case endpoint.RecordTypeMX, endpoint.RecordTypeSRV:
+		if rec.Prio == "" {
+			return rec.Content
+		}
+		return rec.Prio + " " + rec.Content
+	case recordTypeCAA:
+		target, err := normalizeCAA(rec.Content)
+		if err != nil {
+			return rec.Content
+		}
+		return target
+	default:
+		return rec.Content
+	}
+}
+
+// removeNoopTXTUpdates removes unchanged TXT updates from UpdateNew. An update is
+// unchanged if its old endpoint has the same TTL and the same set of targets.
+// UpdateOld is left as-is, entries without a counterpart in UpdateNew are ignored
+// when the updates are applied.
 func removeNoopTXTUpdates(c *plan.Changes) {
 	if len(c.UpdateOld) == 0 || len(c.UpdateNew) == 0 {
 		return
 	}
 
-	type key struct {
-		name   string
-		target string
-	}
-
-	// Map: (DNSName + Content) -> old Endpoint
-	oldMap := make(map[key]*endpoint.Endpoint)
+	// Map: DNSName -> old Endpoint
+	oldMap := make(map[string]*endpoint.Endpoint)
 
 	for _, ep := range c.UpdateOld {
 		if ep.RecordType != endpoint.RecordTypeTXT {
@@ -328,8 +1252,7 @@ func removeNoopTXTUpdates(c *plan.Changes) {
 		if len(ep.Targets) == 0 {
 			continue
 		}
-		k := key{name: ep.DNSName, target: ep.Targets[0]}
-		oldMap[k] = ep
+		oldMap[dnsname.Normalize(ep.DNSName)] = ep
 	}
 
 	// Filter UpdateNew: TXT only keep, if sth. changed
@@ -342,10 +1265,9 @@ func removeNoopTXTUpdates(c *plan.Changes) {
 			continue
 		}
 
-		k := key{name: ep.DNSName, target: ep.Targets[0]}
-		if old, ok := oldMap[k]; ok {
+		if old, ok := oldMap[dnsname.Normalize(ep.DNSName)]; ok {
 			// if TTL and Content same -> No-Op, skip
-			if old.RecordTTL == ep.RecordTTL {
+			if old.RecordTTL == ep.RecordTTL && sameTargets(old.Targets, ep.Targets) {
 				continue
 			}
 		}
@@ -356,12 +1278,25 @@ func removeNoopTXTUpdates(c *plan.Changes) {
 	c.UpdateNew = filtered
 }
 
+// sameTargets reports whether both lists hold the same targets in any order. Unlike
+// Targets.Same, it compares case-sensitively, as TXT contents are, and does not sort
+// the lists in place.
+func sameTargets(a endpoint.Targets, b endpoint.Targets) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sortedA, sortedB := slices.Clone(a), slices.Clone(b)
+	slices.Sort(sortedA)
+	slices.Sort(sortedB)
+	return slices.Equal(sortedA, sortedB)
+}
+
 func getIDforRecord(recordName string, target string, recordType string, recs []pb.Record, useStrictMatchForDelete bool) string {
 	for _, rec := range recs {
-		if rec.Type != recordType || rec.Name != recordName {
+		if rec.Type != recordType || dnsname.Normalize(rec.Name) != dnsname.Normalize(recordName) {
 			continue
 		}
-		if useStrictMatchForDelete && target != rec.Content {
+		if useStrictMatchForDelete && target != endpointTarget(rec) {
 			continue
 		}
 		return rec.ID
@@ -371,12 +1306,13 @@ func getIDforRecord(recordName string, target string, recordType string, recs []
 	return ""
 }
 
-// endpointZoneName determines zoneName for endpoint by taking longest suffix zoneName match in endpoint DNSName
+// endpointZoneName determines zoneName for endpoint by taking the longest zoneName the endpoint DNSName
+// belongs to on DNS label boundaries, ignoring case and trailing dots
 // returns empty string if no match found
 func endpointZoneName(endpoint *endpoint.Endpoint, zones []string) (zone string) {
 	var matchZoneName = ""
 	for _, zoneName := range zones {
-		if strings.HasSuffix(endpoint.DNSName, zoneName) && len(zoneName) > len(matchZoneName) {
+		if dnsname.IsSubdomain(endpoint.DNSName, zoneName) && len(dnsname.Normalize(zoneName)) > len(dnsname.Normalize(matchZoneName)) {
 			matchZoneName = zoneName
 		}
 	}
@@ -386,7 +1322,7 @@ func endpointZoneName(endpoint *endpoint.Endpoint, zones []string) (zone string)
 // ensureLogin makes sure that we are logged in to Porkbun API.
 func (p *PorkbunProvider) ensureLogin(ctx context.Context) error {
 	p.logger.Debug("performing login to Porkbun API")
-	_, err := p.client.Ping(ctx)
+	err := p.ping(ctx)
 	if err != nil {
 		return err
 	}
@@ -16,10 +16,17 @@ package porkbun
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"regexp"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/porkbuntest"
 	pb "github.com/nrdcg/porkbun"
 	"github.com/prometheus/common/promslog"
 
@@ -33,9 +40,32 @@ func TestPorkbunProvider(t *testing.T) {
 	t.Run("GetIDforRecordStrict", testGetIDforRecordStrict)
 	t.Run("GetIDforRecordNonStrict", testGetIDforRecordNonStrict)
 	t.Run("ConvertToPorkbunRecord", testConvertToPorkbunRecord)
+	t.Run("ConvertToPorkbunRecordMultipleTargets", testConvertToPorkbunRecordMultipleTargets)
+	t.Run("DiffUpdatedRecords", testDiffUpdatedRecords)
+	t.Run("DiffUpdatedRecordsPreviousState", testDiffUpdatedRecordsPreviousState)
+	t.Run("MXRecords", testMXRecords)
+	t.Run("SRVContent", testSRVContent)
+	t.Run("SRVTarget", testSRVTarget)
+	t.Run("NormalizeCAA", testNormalizeCAA)
+	t.Run("CAARecords", testCAARecords)
+	t.Run("AliasRecords", testAliasRecords)
+	t.Run("NameNormalization", testNameNormalization)
 	t.Run("NewPorkbunProvider", testNewPorkbunProvider)
+	t.Run("GetDomainFilter", testGetDomainFilter)
+	t.Run("AdjustEndpoints", testAdjustEndpoints)
+	t.Run("AdjustEndpointsZoneConfig", testAdjustEndpointsZoneConfig)
+	t.Run("ApplyChangesZoneConfig", testApplyChangesZoneConfig)
+	t.Run("CheckZonePolicy", testCheckZonePolicy)
+	t.Run("ManagedRecordTypes", testManagedRecordTypes)
+	t.Run("ApplyOrder", testApplyOrder)
+	t.Run("SplitConflictingDeletes", testSplitConflictingDeletes)
 	t.Run("ApplyChanges", testApplyChanges)
+	t.Run("ApplyChangesConcurrently", testApplyChangesConcurrently)
+	t.Run("ApplyChangesWithClient", testApplyChangesWithClient)
 	t.Run("Records", testRecords)
+	t.Run("RecordsWithClient", testRecordsWithClient)
+	t.Run("EndToEnd", testEndToEnd)
+	t.Run("RecordsToEndpoints", testRecordsToEndpoints)
 	t.Run("RemoveNoopTXTUpdates", testRemoveNoopTXTUpdates)
 
 }
@@ -67,6 +97,31 @@ func testEndpointZoneName(t *testing.T) {
 	assert.Equal(t, "bar.org", endpointZoneName(&ep1, zoneList))
 	assert.Equal(t, "", endpointZoneName(&ep2, zoneList))
 	assert.Equal(t, "baz.org", endpointZoneName(&ep3, zoneList))
+
+	tests := []struct {
+		name    string
+		dnsName string
+		zones   []string
+		want    string
+	}{
+		{name: "lookalike apex", dnsName: "foobar.org", zones: []string{"bar.org"}, want: ""},
+		{name: "lookalike subdomain", dnsName: "www.foobar.org", zones: []string{"bar.org"}, want: ""},
+		{name: "lookalike next to real zone", dnsName: "www.foobar.org", zones: []string{"bar.org", "foobar.org"}, want: "foobar.org"},
+		{name: "longest match", dnsName: "www.k8s.example.com", zones: []string{"example.com", "k8s.example.com"}, want: "k8s.example.com"},
+		{name: "longest match in any order", dnsName: "www.k8s.example.com", zones: []string{"k8s.example.com", "example.com"}, want: "k8s.example.com"},
+		{name: "lookalike of the longer zone", dnsName: "www.xk8s.example.com", zones: []string{"example.com", "k8s.example.com"}, want: "example.com"},
+		{name: "mixed case", dnsName: "WWW.Bar.ORG", zones: []string{"bar.org"}, want: "bar.org"},
+		{name: "trailing dot on the name", dnsName: "www.bar.org.", zones: []string{"bar.org"}, want: "bar.org"},
+		{name: "trailing dot on the zone", dnsName: "www.bar.org", zones: []string{"bar.org."}, want: "bar.org."},
+		{name: "no zones", dnsName: "www.bar.org", zones: nil, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := endpoint.NewEndpoint(tt.dnsName, endpoint.RecordTypeA, "5.5.5.5")
+			assert.Equal(t, tt.want, endpointZoneName(ep, tt.zones))
+		})
+	}
 }
 
 func testGetIDforRecordStrict(t *testing.T) {
@@ -146,7 +201,7 @@ func testGetIDforRecordNonStrict(t *testing.T) {
 		t.Fatalf("expected empty ID for unknown record name, got '%s'", unknownID)
 	}
 
-	wrongTypeID := getIDforRecord(recordName, "value-1", "A", pbRecordList, false)
+	wrongTypeID := getIDforRecord(recordName, "value-1", "AAAA", pbRecordList, false)
 	if wrongTypeID != "" {
 		t.Fatalf("expected empty ID for wrong record type, got '%s'", wrongTypeID)
 	}
@@ -161,7 +216,7 @@ func testConvertToPorkbunRecord(t *testing.T) {
 		RecordTTL:  600, // forced minimum
 	}
 
-	// not in zone list
+	// not in zone list, skipped
 	ep2 := endpoint.Endpoint{
 		DNSName:    "foo.foo.org",
 		Targets:    endpoint.Targets{"5.5.5.5"},
@@ -178,7 +233,7 @@ func testConvertToPorkbunRecord(t *testing.T) {
 	}
 
 	ep4 := endpoint.Endpoint{
-		DNSName:    "foo.baz.org",
+		DNSName:    "foo.bar.org",
 		Targets:    endpoint.Targets{"\"heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/nginx\""},
 		RecordType: endpoint.RecordTypeTXT,
 		RecordTTL:  600, // forced minimum
@@ -229,15 +284,396 @@ func testConvertToPorkbunRecord(t *testing.T) {
 		TTL:     "600",
 	}
 
+	pb4Converted := pb.Record{
+		ID:      "",
+		Name:    "foo",
+		Type:    "TXT",
+		Content: "heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/nginx",
+		TTL:     "600",
+	}
+
 	// The retrieved records include the zone
 	pbRetrievedRecordList := []pb.Record{pb1Retrieved, pb2, pb3retrieved, pb4}
 	// The records we want to create should not include the zone
-	pbRecordList := []pb.Record{pb1, pb2, pb3, pb4}
+	pbRecordList := []pb.Record{pb1, pb3, pb4Converted}
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	assert.Equal(t, pbRecordList, convertToPorkbunRecord(logger, pbRetrievedRecordList, epList, "bar.org", false))
 }
 
+func testConvertToPorkbunRecordMultipleTargets(t *testing.T) {
+	ep1 := endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1", "2.2.2.2")
+	ep2 := endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeTXT, 600, "v=spf1 -all", "\"heritage=external-dns,external-dns/owner=default\"")
+
+	retrieved := []pb.Record{
+		{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "2", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		{ID: "3", Name: "example.com", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=default", TTL: "600"},
+	}
+
+	expected := []pb.Record{
+		{ID: "1", Name: "www", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "2", Name: "www", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		{ID: "", Name: "", Type: "TXT", Content: "v=spf1 -all", TTL: "600"},
+		{ID: "3", Name: "", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=default", TTL: "600"},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	assert.Equal(t, expected, convertToPorkbunRecord(logger, retrieved, []*endpoint.Endpoint{ep1, ep2}, "example.com", true))
+}
+
+func testDiffUpdatedRecords(t *testing.T) {
+	retrieved := []pb.Record{
+		// kept, unchanged
+		{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		// reused for the new target 3.3.3.3
+		{ID: "2", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		// kept, TTL changed
+		{ID: "3", Name: "ttl.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		// surplus, deleted
+		{ID: "4", Name: "shrink.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "5", Name: "shrink.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		// other type at the same name, untouched
+		{ID: "6", Name: "www.example.com", Type: "TXT", Content: "v=1", TTL: "600"},
+	}
+
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1", "3.3.3.3", "4.4.4.4"),
+		endpoint.NewEndpointWithTTL("ttl.example.com", endpoint.RecordTypeA, 3600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("shrink.example.com", endpoint.RecordTypeA, 600, "2.2.2.2"),
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	create, update, del := diffUpdatedRecords(logger, retrieved, nil, endpoints, "example.com")
+
+	assert.Equal(t, []pb.Record{
+		{Name: "www", Type: "A", Content: "4.4.4.4", TTL: "600"},
+	}, create)
+	assert.Equal(t, []pb.Record{
+		{ID: "2", Name: "www", Type: "A", Content: "3.3.3.3", TTL: "600"},
+		{ID: "3", Name: "ttl", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+	}, update)
+	assert.Equal(t, []pb.Record{
+		{ID: "4", Name: "shrink.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}, del)
+}
+
+func testDiffUpdatedRecordsPreviousState(t *testing.T) {
+	retrieved := []pb.Record{
+		// several TXT records at one name, only the one in the previous state is edited
+		{ID: "1", Name: "www.example.com", Type: "TXT", Content: "google-site-verification=abc", TTL: "600"},
+		{ID: "2", Name: "www.example.com", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=old", TTL: "600"},
+		{ID: "3", Name: "www.example.com", Type: "TXT", Content: "v=spf1 -all", TTL: "600"},
+		// A records, one of them added by hand since the plan was made
+		{ID: "4", Name: "api.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "5", Name: "api.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		{ID: "6", Name: "api.example.com", Type: "A", Content: "5.5.5.5", TTL: "600"},
+		// duplicate records, only as many are claimed as the previous state has targets
+		{ID: "7", Name: "dup.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "8", Name: "dup.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}
+
+	updateOld := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "\"heritage=external-dns,external-dns/owner=old\""),
+		endpoint.NewEndpointWithTTL("API.example.com.", endpoint.RecordTypeA, 600, "1.1.1.1", "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("dup.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		// previous target that no longer exists in the zone
+		endpoint.NewEndpointWithTTL("gone.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+	}
+	updateNew := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "\"heritage=external-dns,external-dns/owner=new\""),
+		endpoint.NewEndpointWithTTL("api.example.com", endpoint.RecordTypeA, 600, "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("dup.example.com", endpoint.RecordTypeA, 600, "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("gone.example.com", endpoint.RecordTypeA, 600, "2.2.2.2"),
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	create, update, del := diffUpdatedRecords(logger, retrieved, updateOld, updateNew, "example.com")
+
+	assert.Equal(t, []pb.Record{
+		{Name: "gone", Type: "A", Content: "2.2.2.2", TTL: "600"},
+	}, create)
+	assert.Equal(t, []pb.Record{
+		{ID: "2", Name: "www", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=new", TTL: "600"},
+		{ID: "7", Name: "dup", Type: "A", Content: "3.3.3.3", TTL: "600"},
+	}, update)
+	assert.Equal(t, []pb.Record{
+		{ID: "4", Name: "api.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}, del)
+
+	// without the previous state all records with the name and type are updated
+	_, update, del = diffUpdatedRecords(logger, retrieved, nil, updateNew[:1], "example.com")
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "www", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=new", TTL: "600"},
+	}, update)
+	assert.Equal(t, []pb.Record{
+		{ID: "2", Name: "www.example.com", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=old", TTL: "600"},
+		{ID: "3", Name: "www.example.com", Type: "TXT", Content: "v=spf1 -all", TTL: "600"},
+	}, del)
+
+	// switching a CNAME to an ALIAS record edits the CNAME record
+	retrieved = []pb.Record{
+		{ID: "9", Name: "alias.example.com", Type: "CNAME", Content: "lb.example.net", TTL: "600"},
+	}
+	updateOld = []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("alias.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net")}
+	updateNew = []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("alias.example.com", recordTypeALIAS, 600, "lb.example.net")}
+	create, update, del = diffUpdatedRecords(logger, retrieved, updateOld, updateNew, "example.com")
+	assert.Empty(t, create)
+	assert.Equal(t, []pb.Record{
+		{ID: "9", Name: "alias", Type: "ALIAS", Content: "lb.example.net", TTL: "600"},
+	}, update)
+	assert.Empty(t, del)
+}
+
+func testMXRecords(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	inline := endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com", "20 backup.example.com")
+	property := endpoint.NewEndpointWithTTL("sub.example.com", endpoint.RecordTypeMX, 600, "mail.example.com").
+		WithProviderSpecific(providerSpecificPriority, "5")
+	invalid := endpoint.NewEndpointWithTTL("invalid.example.com", endpoint.RecordTypeMX, 600, "high mail.example.com", "1 2 3")
+	invalidProperty := endpoint.NewEndpointWithTTL("invalid.example.com", endpoint.RecordTypeMX, 600, "mail.example.com").
+		WithProviderSpecific(providerSpecificPriority, "-1")
+
+	retrieved := []pb.Record{
+		{ID: "1", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "2", Name: "example.com", Type: "MX", Content: "backup.example.com", Prio: "20", TTL: "600"},
+	}
+
+	// write: the priority moves out of the content
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "2", Name: "", Type: "MX", Content: "backup.example.com", Prio: "20", TTL: "600"},
+		{Name: "sub", Type: "MX", Content: "mail.example.com", Prio: "5", TTL: "600"},
+	}, convertToPorkbunRecord(logger, retrieved, []*endpoint.Endpoint{inline, property, invalid, invalidProperty}, "example.com", true))
+
+	// read: the priority is put back in front of the content
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com", "20 backup.example.com"),
+	}, recordsToEndpoints(logger, "example.com", retrieved, false))
+
+	// round trip: no update necessary
+	create, update, del := diffUpdatedRecords(logger, retrieved, nil, []*endpoint.Endpoint{inline}, "example.com")
+	assert.Empty(t, create)
+	assert.Empty(t, update)
+	assert.Empty(t, del)
+
+	// priority change only: edited in place
+	changed := endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com", "30 backup.example.com")
+	create, update, del = diffUpdatedRecords(logger, retrieved, nil, []*endpoint.Endpoint{changed}, "example.com")
+	assert.Empty(t, create)
+	assert.Equal(t, []pb.Record{
+		{ID: "2", Name: "", Type: "MX", Content: "backup.example.com", Prio: "30", TTL: "600"},
+	}, update)
+	assert.Empty(t, del)
+}
+
+func testSRVContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		target  string
+		content string
+		prio    string
+		wantErr bool
+	}{
+		{name: "valid", target: "10 60 5060 sip.example.com", content: "60 5060 sip.example.com", prio: "10"},
+		{name: "trailing dot", target: "10 60 5060 sip.example.com.", content: "60 5060 sip.example.com.", prio: "10"},
+		{name: "extra whitespace", target: " 0  5\t443   svc.example.com ", content: "5 443 svc.example.com", prio: "0"},
+		{name: "null target", target: "0 0 0 .", content: "0 0 .", prio: "0"},
+		{name: "maximum values", target: "65535 65535 65535 svc.example.com", content: "65535 65535 svc.example.com", prio: "65535"},
+		{name: "missing host", target: "10 60 5060", wantErr: true},
+		{name: "too many fields", target: "10 60 5060 sip.example.com extra", wantErr: true},
+		{name: "empty", target: "", wantErr: true},
+		{name: "priority not a number", target: "high 60 5060 sip.example.com", wantErr: true},
+		{name: "negative weight", target: "10 -1 5060 sip.example.com", wantErr: true},
+		{name: "port out of range", target: "10 60 65536 sip.example.com", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ep := endpoint.NewEndpoint("_sip._tcp.example.com", endpoint.RecordTypeSRV, tt.target)
+			content, prio, err := porkbunContent(ep, tt.target)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.content, content)
+			assert.Equal(t, tt.prio, prio)
+		})
+	}
+}
+
+func testSRVTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		record pb.Record
+		target string
+	}{
+		{name: "priority split out", record: pb.Record{Type: "SRV", Content: "60 5060 sip.example.com", Prio: "10"}, target: "10 60 5060 sip.example.com"},
+		{name: "zero priority", record: pb.Record{Type: "SRV", Content: "5 443 svc.example.com", Prio: "0"}, target: "0 5 443 svc.example.com"},
+		{name: "missing priority", record: pb.Record{Type: "SRV", Content: "5 443 svc.example.com"}, target: "5 443 svc.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.target, endpointTarget(tt.record))
+		})
+	}
+
+	// round trip through Records and back to the API does not produce updates
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	retrieved := []pb.Record{
+		{ID: "1", Name: "_sip._tcp.example.com", Type: "SRV", Content: "60 5060 sip.example.com", Prio: "10", TTL: "600"},
+		{ID: "2", Name: "_sip._tcp.example.com", Type: "SRV", Content: "40 5060 sip2.example.com", Prio: "10", TTL: "600"},
+	}
+	endpoints := recordsToEndpoints(logger, "example.com", retrieved, false)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", endpoint.RecordTypeSRV, 600, "10 60 5060 sip.example.com", "10 40 5060 sip2.example.com"),
+	}, endpoints)
+
+	create, update, del := diffUpdatedRecords(logger, retrieved, nil, endpoints, "example.com")
+	assert.Empty(t, create)
+	assert.Empty(t, update)
+	assert.Empty(t, del)
+}
+
+func testNormalizeCAA(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "quoted", value: `0 issue "letsencrypt.org"`, want: `0 issue "letsencrypt.org"`},
+		{name: "unquoted", value: `0 issue letsencrypt.org`, want: `0 issue "letsencrypt.org"`},
+		{name: "upper-case tag", value: `0 ISSUE "letsencrypt.org"`, want: `0 issue "letsencrypt.org"`},
+		{name: "critical flag", value: `128 issuewild ";"`, want: `128 issuewild ";"`},
+		{name: "extra whitespace", value: `  0   iodef   "mailto:security@example.com" `, want: `0 iodef "mailto:security@example.com"`},
+		{name: "value with parameters", value: `0 issue letsencrypt.org; validationmethods=dns-01`, want: `0 issue "letsencrypt.org; validationmethods=dns-01"`},
+		{name: "empty quoted value", value: `0 issue ""`, want: `0 issue ""`},
+		{name: "leading zero flags", value: `00 issue "letsencrypt.org"`, want: `0 issue "letsencrypt.org"`},
+		{name: "missing value", value: `0 issue`, wantErr: true},
+		{name: "flags out of range", value: `256 issue "letsencrypt.org"`, wantErr: true},
+		{name: "flags not a number", value: `critical issue "letsencrypt.org"`, wantErr: true},
+		{name: "invalid tag", value: `0 is-sue "letsencrypt.org"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeCAA(tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			// normalizing is idempotent
+			again, err := normalizeCAA(got)
+			assert.NoError(t, err)
+			assert.Equal(t, got, again)
+		})
+	}
+}
+
+func testCAARecords(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	retrieved := []pb.Record{
+		{ID: "1", Name: "example.com", Type: "CAA", Content: `0 issue "letsencrypt.org"`, TTL: "600"},
+		{ID: "2", Name: "example.com", Type: "CAA", Content: `0 iodef mailto:security@example.com`, TTL: "600"},
+	}
+
+	endpoints := recordsToEndpoints(logger, "example.com", retrieved, false)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", recordTypeCAA, 600, `0 issue "letsencrypt.org"`, `0 iodef "mailto:security@example.com"`),
+	}, endpoints)
+
+	desired := endpoint.NewEndpointWithTTL("example.com", recordTypeCAA, 600, `0 ISSUE letsencrypt.org`, `0 iodef "mailto:security@example.com"`, `0 issuewild ";"`)
+	create, update, del := diffUpdatedRecords(logger, retrieved, nil, []*endpoint.Endpoint{desired}, "example.com")
+	assert.Equal(t, []pb.Record{
+		{Name: "", Type: "CAA", Content: `0 issuewild ";"`, TTL: "600"},
+	}, create)
+	assert.Empty(t, update)
+	assert.Empty(t, del)
+}
+
+func testAliasRecords(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	apex := endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net")
+	marked := endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net").
+		WithProviderSpecific(providerSpecificAlias, "true")
+	plain := endpoint.NewEndpointWithTTL("api.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net")
+	other := endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeA, 600, "1.1.1.1")
+
+	aliased := aliasEndpoints([]*endpoint.Endpoint{apex, marked, plain, other}, "example.com")
+	assert.Equal(t, []string{recordTypeALIAS, recordTypeALIAS, endpoint.RecordTypeCNAME, endpoint.RecordTypeA},
+		[]string{aliased[0].RecordType, aliased[1].RecordType, aliased[2].RecordType, aliased[3].RecordType})
+	// the original endpoints are left untouched
+	assert.Equal(t, endpoint.RecordTypeCNAME, apex.RecordType)
+	assert.Same(t, plain, aliased[2])
+
+	assert.Equal(t, []pb.Record{
+		{Name: "", Type: "ALIAS", Content: "lb.example.net", TTL: "600"},
+		{Name: "www", Type: "ALIAS", Content: "lb.example.net", TTL: "600"},
+	}, convertToPorkbunRecord(logger, nil, aliased[:2], "example.com", false))
+
+	retrieved := []pb.Record{
+		{ID: "1", Name: "example.com", Type: "ALIAS", Content: "lb.example.net", TTL: "600"},
+		{ID: "2", Name: "www.example.com", Type: "ALIAS", Content: "lb.example.net", TTL: "600"},
+	}
+
+	// reported as CNAME so that the plan stays stable
+	assert.Equal(t, []*endpoint.Endpoint{apex, marked}, recordsToEndpoints(logger, "example.com", retrieved, true))
+
+	// without alias support ALIAS records are reported as they are
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", recordTypeALIAS, 600, "lb.example.net"),
+		endpoint.NewEndpointWithTTL("www.example.com", recordTypeALIAS, 600, "lb.example.net"),
+	}, recordsToEndpoints(logger, "example.com", retrieved, false))
+
+	// round trip
+	create, update, del := diffUpdatedRecords(logger, retrieved, nil, aliased[:2], "example.com")
+	assert.Empty(t, create)
+	assert.Empty(t, update)
+	assert.Empty(t, del)
+}
+
+func testNameNormalization(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	retrieved := []pb.Record{
+		{ID: "1", Name: "example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "2", Name: "*.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "3", Name: "WWW.Example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "4", Name: "xn--bcher-kva.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}
+
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("*.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("xn--bcher-kva.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+	}, recordsToEndpoints(logger, "Example.com.", retrieved, false))
+
+	endpoints := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("Example.com.", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("*.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.EXAMPLE.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("bücher.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.notexample.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+	}
+
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "2", Name: "*", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "3", Name: "www", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "4", Name: "xn--bcher-kva", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}, convertToPorkbunRecord(logger, retrieved, endpoints, "example.com", true))
+}
+
 func testNewPorkbunProvider(t *testing.T) {
 	domainFilter := []string{"example.com"}
 	var logger *slog.Logger
@@ -247,6 +683,19 @@ func testNewPorkbunProvider(t *testing.T) {
 	p, err := NewPorkbunProvider(domainFilter, "KEY", "PASSWORD", true, logger)
 	assert.NotNil(t, p.client)
 	assert.NoError(t, err)
+	assert.False(t, p.aliasRecords)
+
+	p, err = NewPorkbunProvider(domainFilter, "KEY", "PASSWORD", true, logger, WithAliasRecords(true))
+	assert.NoError(t, err)
+	assert.True(t, p.aliasRecords)
+
+	client := newFakeClient(nil)
+	p, err = NewPorkbunProvider(domainFilter, "KEY", "PASSWORD", true, logger, WithClient(client))
+	assert.NoError(t, err)
+	assert.Same(t, client, p.client)
+
+	_, err = NewPorkbunProvider(domainFilter, "KEY", "PASSWORD", true, logger, WithClient(nil))
+	assert.Error(t, err)
 
 	_, err = NewPorkbunProvider(domainFilter, "", "PASSWORD", true, logger)
 	assert.Error(t, err)
@@ -260,6 +709,336 @@ func testNewPorkbunProvider(t *testing.T) {
 
 }
 
+func testGetDomainFilter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.org"}, "KEY", "PASSWORD", true, logger)
+	assert.NoError(t, err)
+
+	filter := p.GetDomainFilter()
+	assert.True(t, filter.Match("www.example.com"))
+	assert.True(t, filter.Match("example.org"))
+	assert.False(t, filter.Match("example.net"))
+
+	// the filter is what the webhook negotiation sends to external-dns
+	serialized, err := json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"include":["example.com","example.org"]}`, string(serialized))
+
+	// serializing sorts the filter lists in place, which must not race with the provider
+	p, err = NewPorkbunProvider([]string{"example.org", "example.com"}, "KEY", "PASSWORD", true, logger)
+	assert.NoError(t, err)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := json.Marshal(p.GetDomainFilter())
+		assert.NoError(t, err)
+	}()
+	assert.Equal(t, []string{"example.org", "example.com"}, p.knownZones())
+	wg.Wait()
+	assert.Equal(t, []string{"example.org", "example.com"}, p.knownZones())
+
+	// exclusions
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithDomainExclusions([]string{"internal.example.com"}))
+	assert.NoError(t, err)
+	filter = p.GetDomainFilter()
+	assert.True(t, filter.Match("www.example.com"))
+	assert.False(t, filter.Match("internal.example.com"))
+	assert.False(t, filter.Match("www.internal.example.com"))
+	serialized, err = json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"include":["example.com"],"exclude":["internal.example.com"]}`, string(serialized))
+
+	// regular expressions take precedence, the domain filter list still names the zones
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger,
+		WithRegexDomainFilter(regexp.MustCompile(`\.k8s\.example\.com$`), nil))
+	assert.NoError(t, err)
+	filter = p.GetDomainFilter()
+	assert.True(t, filter.Match("www.k8s.example.com"))
+	assert.False(t, filter.Match("www.example.com"))
+	assert.Equal(t, []string{"example.com"}, p.knownZones())
+	serialized, err = json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"regexInclude":"\\.k8s\\.example\\.com$"}`, string(serialized))
+
+	// as in external-dns, the exclusion takes precedence over the regular expression
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger,
+		WithRegexDomainFilter(regexp.MustCompile(`\.k8s\.example\.com$`), regexp.MustCompile(`^internal\.`)))
+	assert.NoError(t, err)
+	filter = p.GetDomainFilter()
+	assert.True(t, filter.Match("www.k8s.example.com"))
+	assert.False(t, filter.Match("internal.k8s.example.com"))
+	serialized, err = json.Marshal(filter)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"regexInclude":"\\.k8s\\.example\\.com$","regexExclude":"^internal\\."}`, string(serialized))
+
+	// a regular expression alone does not name any zones
+	_, err = NewPorkbunProvider(nil, "KEY", "PASSWORD", true, logger, WithRegexDomainFilter(regexp.MustCompile(`example\.com$`), nil))
+	assert.Error(t, err)
+	_, err = NewPorkbunProvider(nil, "KEY", "PASSWORD", true, logger,
+		WithRegexDomainFilter(regexp.MustCompile(`example\.com$`), nil), WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+}
+
+func testAdjustEndpoints(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithAliasRecords(true))
+	assert.NoError(t, err)
+
+	endpoints := []*endpoint.Endpoint{
+		// TTL below the minimum
+		endpoint.NewEndpointWithTTL("low.example.com", endpoint.RecordTypeA, 60, "1.1.1.1"),
+		// TTL not configured
+		endpoint.NewEndpoint("unset.example.com", endpoint.RecordTypeA, "1.1.1.1"),
+		// unsupported record type
+		endpoint.NewEndpoint("1.1.1.1.in-addr.arpa", endpoint.RecordTypePTR, "host.example.com"),
+		// name normalization and lower-case record type
+		{DNSName: "WWW.Example.com.", RecordType: "cname", RecordTTL: 3600, Targets: endpoint.Targets{"lb.example.net"}},
+		// set identifiers are stripped and the endpoints merged
+		endpoint.NewEndpointWithTTL("weighted.example.com", endpoint.RecordTypeA, 900, "1.1.1.1").WithSetIdentifier("a"),
+		endpoint.NewEndpointWithTTL("weighted.example.com", endpoint.RecordTypeA, 600, "2.2.2.2", "1.1.1.1").WithSetIdentifier("b"),
+		// MX priority property folded into the target
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "mail.example.com").WithProviderSpecific(providerSpecificPriority, "10"),
+		// SRV whitespace
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", endpoint.RecordTypeSRV, 600, "10  60 5060   sip.example.com"),
+		// CAA quoting, invalid targets dropped
+		endpoint.NewEndpointWithTTL("example.com", recordTypeCAA, 600, "0 ISSUE letsencrypt.org", "invalid"),
+		// no valid targets left
+		endpoint.NewEndpointWithTTL("invalid.example.com", endpoint.RecordTypeMX, 600, "a b c"),
+		// alias property is only kept below the apex
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net").WithProviderSpecific(providerSpecificAlias, "true"),
+		endpoint.NewEndpointWithTTL("alias.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net").WithProviderSpecific(providerSpecificAlias, "true"),
+		endpoint.NewEndpointWithTTL("noalias.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net").WithProviderSpecific(providerSpecificAlias, "false"),
+	}
+
+	adjusted, err := p.AdjustEndpoints(endpoints)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("low.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpoint("unset.example.com", endpoint.RecordTypeA, "1.1.1.1"),
+		{DNSName: "www.example.com", RecordType: endpoint.RecordTypeCNAME, RecordTTL: 3600, Targets: endpoint.Targets{"lb.example.net"}},
+		endpoint.NewEndpointWithTTL("weighted.example.com", endpoint.RecordTypeA, 600, "1.1.1.1", "2.2.2.2"),
+		{DNSName: "example.com", RecordType: endpoint.RecordTypeMX, RecordTTL: 600, Targets: endpoint.Targets{"10 mail.example.com"}, Labels: endpoint.Labels{}, ProviderSpecific: endpoint.ProviderSpecific{}},
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", endpoint.RecordTypeSRV, 600, "10 60 5060 sip.example.com"),
+		endpoint.NewEndpointWithTTL("example.com", recordTypeCAA, 600, `0 issue "letsencrypt.org"`),
+		{DNSName: "example.com", RecordType: endpoint.RecordTypeCNAME, RecordTTL: 600, Targets: endpoint.Targets{"lb.example.net"}, Labels: endpoint.Labels{}, ProviderSpecific: endpoint.ProviderSpecific{}},
+		endpoint.NewEndpointWithTTL("alias.example.com", endpoint.RecordTypeCNAME, 600, "lb.example.net").WithProviderSpecific(providerSpecificAlias, "true"),
+		{DNSName: "noalias.example.com", RecordType: endpoint.RecordTypeCNAME, RecordTTL: 600, Targets: endpoint.Targets{"lb.example.net"}, Labels: endpoint.Labels{}, ProviderSpecific: endpoint.ProviderSpecific{}},
+	}, adjusted)
+
+	// adjusted endpoints match what Records reports for the same records
+	retrieved := []pb.Record{
+		{ID: "1", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "2", Name: "_sip._tcp.example.com", Type: "SRV", Content: "60 5060 sip.example.com", Prio: "10", TTL: "600"},
+		{ID: "3", Name: "example.com", Type: "CAA", Content: `0 issue "letsencrypt.org"`, TTL: "600"},
+	}
+	for i, ep := range recordsToEndpoints(logger, "example.com", retrieved, true) {
+		assert.Equal(t, ep.Targets, adjusted[4+i].Targets)
+	}
+}
+
+func testZoneConfigProvider(t *testing.T) *PorkbunProvider {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	config := &Config{
+		Zones: map[string]ZoneConfig{
+			"example.com": {
+				DefaultTTL:       3600,
+				MinTTL:           900,
+				AllowedTypes:     []string{"A", "TXT"},
+				ProtectedRecords: []string{"@", "mail"},
+			},
+			"example.org": {
+				ReadOnly: true,
+			},
+		},
+	}
+	assert.NoError(t, config.normalize())
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.org", "example.net"}, "KEY", "PASSWORD", true, logger, WithConfig(config))
+	assert.NoError(t, err)
+	return p
+}
+
+func testAdjustEndpointsZoneConfig(t *testing.T) {
+	p := testZoneConfigProvider(t)
+
+	adjusted, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		// default TTL
+		endpoint.NewEndpoint("default.example.com", endpoint.RecordTypeA, "1.1.1.1"),
+		// minimum TTL of the zone
+		endpoint.NewEndpointWithTTL("low.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		// type not allowed in the zone
+		endpoint.NewEndpoint("cname.example.com", endpoint.RecordTypeCNAME, "www.example.com"),
+		// other zones keep the Porkbun defaults
+		endpoint.NewEndpoint("default.example.net", endpoint.RecordTypeCNAME, "www.example.com"),
+		endpoint.NewEndpointWithTTL("low.example.net", endpoint.RecordTypeA, 300, "1.1.1.1"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("default.example.com", endpoint.RecordTypeA, 3600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("low.example.com", endpoint.RecordTypeA, 900, "1.1.1.1"),
+		endpoint.NewEndpoint("default.example.net", endpoint.RecordTypeCNAME, "www.example.com"),
+		endpoint.NewEndpointWithTTL("low.example.net", endpoint.RecordTypeA, 600, "1.1.1.1"),
+	}, adjusted)
+}
+
+func testApplyChangesZoneConfig(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client := newFakeClient(map[string][]pb.Record{
+		"example.com": {
+			{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+		},
+		"example.net": {},
+	})
+	config := &Config{Zones: map[string]ZoneConfig{"example.com": {DefaultTTL: 3600, MinTTL: 900}}}
+	assert.NoError(t, config.normalize())
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.net"}, "KEY", "SECRET", false, logger,
+		WithClient(client), WithConfig(config))
+	assert.NoError(t, err)
+
+	// endpoints that did not pass through AdjustEndpoints get the zone TTL settings
+	created := endpoint.NewEndpoint("default.example.com", endpoint.RecordTypeA, "1.1.1.1")
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create:    []*endpoint.Endpoint{created},
+		UpdateOld: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 3600, "1.1.1.1")},
+		UpdateNew: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "900"},
+		{ID: "1001", Name: "default.example.com", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+	}, client.records["example.com"])
+
+	// the endpoints of the plan are left alone
+	assert.False(t, created.RecordTTL.IsConfigured())
+
+	// other zones get the Porkbun minimum
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{endpoint.NewEndpointWithTTL("low.example.net", endpoint.RecordTypeA, 300, "1.1.1.1")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []pb.Record{
+		{ID: "1002", Name: "low.example.net", Type: "A", Content: "1.1.1.1", TTL: "600"},
+	}, client.records["example.net"])
+}
+
+func testCheckZonePolicy(t *testing.T) {
+	p := testZoneConfigProvider(t)
+
+	tests := []struct {
+		name    string
+		zone    string
+		ep      *endpoint.Endpoint
+		wantErr string
+	}{
+		{name: "allowed", zone: "example.com", ep: endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "1.1.1.1")},
+		{name: "type not allowed", zone: "example.com", ep: endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeCNAME, "a.example.com"), wantErr: "record type CNAME is not allowed in zone example.com"},
+		{name: "read-only zone", zone: "example.org", ep: endpoint.NewEndpoint("www.example.org", endpoint.RecordTypeA, "1.1.1.1"), wantErr: "zone example.org is read-only"},
+		{name: "unconfigured zone", zone: "example.net", ep: endpoint.NewEndpoint("example.net", endpoint.RecordTypeMX, "10 mail.example.net")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.checkZonePolicy(tt.zone, tt.ep)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func testManagedRecordTypes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger)
+	assert.NoError(t, err)
+	assert.True(t, p.managesType(endpoint.RecordTypeMX))
+
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithManagedRecordTypes([]string{"A", "PTR"}))
+	assert.EqualError(t, err, "managed record type PTR is not supported")
+
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithManagedRecordTypes([]string{"a", "AAAA", " CNAME", "TXT"}))
+	assert.NoError(t, err)
+	assert.True(t, p.managesType(endpoint.RecordTypeA))
+	assert.True(t, p.managesType(endpoint.RecordTypeCNAME))
+	assert.False(t, p.managesType(endpoint.RecordTypeMX))
+	assert.False(t, p.managesType(endpoint.RecordTypeNS))
+
+	adjusted, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "heritage=external-dns"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "heritage=external-dns"),
+	}, adjusted)
+
+	assert.NoError(t, p.checkZonePolicy("example.com", endpoint.NewEndpoint("www.example.com", endpoint.RecordTypeA, "1.1.1.1")))
+	assert.EqualError(t, p.checkZonePolicy("example.com", endpoint.NewEndpoint("example.com", endpoint.RecordTypeNS, "ns1.example.net")), "record type NS is not managed")
+}
+
+func testApplyOrder(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger)
+	assert.NoError(t, err)
+	assert.Equal(t, ApplyOrderDeleteFirst, p.applyOrder)
+
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithApplyOrder(""))
+	assert.NoError(t, err)
+	assert.Equal(t, ApplyOrderDeleteFirst, p.applyOrder)
+
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithApplyOrder(ApplyOrderCreateFirst))
+	assert.NoError(t, err)
+	assert.Equal(t, ApplyOrderCreateFirst, p.applyOrder)
+
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", true, logger, WithApplyOrder("random"))
+	assert.EqualError(t, err, `unknown apply order "random", expected delete-first or create-first`)
+}
+
+func testSplitConflictingDeletes(t *testing.T) {
+	change := &PorkbunChange{
+		Create: []pb.Record{
+			{Name: "www", Type: "A", Content: "2.2.2.2"},
+			{Name: "cname", Type: "CNAME", Content: "lb.example.net"},
+		},
+		DesiredAfterUpdate: []pb.Record{
+			{ID: "10", Name: "", Type: "ALIAS", Content: "lb.example.net"},
+		},
+		Delete: []pb.Record{
+			// replaced by the new A record, deleted afterwards
+			{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1"},
+			// CNAME records are deleted first
+			{ID: "2", Name: "old.example.com", Type: "CNAME", Content: "lb.example.net"},
+			// records at names that get a CNAME or ALIAS record are deleted first
+			{ID: "3", Name: "cname.example.com", Type: "A", Content: "1.1.1.1"},
+			{ID: "4", Name: "example.com", Type: "A", Content: "1.1.1.1"},
+			{ID: "5", Name: "mail.example.com", Type: "MX", Content: "mail.example.com", Prio: "10"},
+		},
+	}
+
+	first, last := splitConflictingDeletes(change, "example.com")
+	assert.Equal(t, []pb.Record{
+		{ID: "2", Name: "old.example.com", Type: "CNAME", Content: "lb.example.net"},
+		{ID: "3", Name: "cname.example.com", Type: "A", Content: "1.1.1.1"},
+		{ID: "4", Name: "example.com", Type: "A", Content: "1.1.1.1"},
+	}, first)
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1"},
+		{ID: "5", Name: "mail.example.com", Type: "MX", Content: "mail.example.com", Prio: "10"},
+	}, last)
+}
+
 func testApplyChanges(t *testing.T) {
 	domainFilter := []string{"example.com"}
 	var logger *slog.Logger
@@ -322,6 +1101,136 @@ func testApplyChanges(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// slowRecordClient changes records like its fakeClient, taking latency for every
+// change, and tracks how many changes were made at the same time.
+type slowRecordClient struct {
+	*fakeClient
+	latency time.Duration
+
+	inFlightMu  sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (c *slowRecordClient) change(fn func() error) error {
+	c.inFlightMu.Lock()
+	c.inFlight++
+	c.maxInFlight = max(c.maxInFlight, c.inFlight)
+	c.inFlightMu.Unlock()
+
+	time.Sleep(c.latency)
+	err := fn()
+
+	c.inFlightMu.Lock()
+	c.inFlight--
+	c.inFlightMu.Unlock()
+	return err
+}
+
+func (c *slowRecordClient) CreateRecord(ctx context.Context, domain string, record pb.Record) (int, error) {
+	var id int
+	err := c.change(func() error {
+		var err error
+		id, err = c.fakeClient.CreateRecord(ctx, domain, record)
+		return err
+	})
+	return id, err
+}
+
+func (c *slowRecordClient) EditRecord(ctx context.Context, domain string, id int, record pb.Record) error {
+	return c.change(func() error { return c.fakeClient.EditRecord(ctx, domain, id, record) })
+}
+
+func (c *slowRecordClient) DeleteRecord(ctx context.Context, domain string, id int) error {
+	return c.change(func() error { return c.fakeClient.DeleteRecord(ctx, domain, id) })
+}
+
+func testApplyChangesConcurrently(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	zones := []string{"example.com", "example.org", "example.net"}
+
+	changes := &plan.Changes{}
+	for _, zone := range zones {
+		changes.Create = append(changes.Create, endpoint.NewEndpointWithTTL("new."+zone, endpoint.RecordTypeA, 600, "2.2.2.2", "3.3.3.3"))
+		changes.Delete = append(changes.Delete,
+			endpoint.NewEndpointWithTTL("a."+zone, endpoint.RecordTypeA, 600, "1.1.1.1"),
+			endpoint.NewEndpointWithTTL("b."+zone, endpoint.RecordTypeA, 600, "1.1.1.1"))
+	}
+
+	newServer := func(t *testing.T) *porkbuntest.Server {
+		server := porkbuntest.NewServer("KEY", "SECRET")
+		t.Cleanup(server.Close)
+		for i, zone := range zones {
+			server.AddDomain(zone,
+				pb.Record{ID: fmt.Sprint(i*10 + 1), Name: "a", Type: "A", Content: "1.1.1.1"},
+				pb.Record{ID: fmt.Sprint(i*10 + 2), Name: "b", Type: "A", Content: "1.1.1.1"})
+		}
+		return server
+	}
+
+	_, err := NewPorkbunProvider(zones, "KEY", "SECRET", false, logger, WithConcurrency(0, 1))
+	assert.Error(t, err)
+
+	t.Run("bounded", func(t *testing.T) {
+		server := newServer(t)
+		server.SetLatency(20 * time.Millisecond)
+		p, err := NewPorkbunProvider(zones, "KEY", "SECRET", false, logger, WithConcurrency(2, 2), WithBaseURL(server.URL))
+		assert.NoError(t, err)
+
+		assert.NoError(t, p.ApplyChanges(context.TODO(), changes))
+		assert.ElementsMatch(t, []string{
+			"delete example.com 1", "delete example.com 2", "create example.com new A 2.2.2.2 600", "create example.com new A 3.3.3.3 600",
+			"delete example.org 11", "delete example.org 12", "create example.org new A 2.2.2.2 600", "create example.org new A 3.3.3.3 600",
+			"delete example.net 21", "delete example.net 22", "create example.net new A 2.2.2.2 600", "create example.net new A 3.3.3.3 600",
+		}, server.MutationLog())
+		assert.Greater(t, server.MaxConcurrentRequests(), 1)
+		assert.LessOrEqual(t, server.MaxConcurrentRequests(), 4)
+	})
+
+	t.Run("global cap", func(t *testing.T) {
+		_, err := NewPorkbunProvider(zones, "KEY", "SECRET", false, logger, WithGlobalConcurrency(-1))
+		assert.Error(t, err)
+
+		records := map[string][]pb.Record{}
+		for i, zone := range zones {
+			records[zone] = []pb.Record{
+				{ID: fmt.Sprint(i*10 + 1), Name: "a." + zone, Type: "A", Content: "1.1.1.1", TTL: "600"},
+				{ID: fmt.Sprint(i*10 + 2), Name: "b." + zone, Type: "A", Content: "1.1.1.1", TTL: "600"},
+			}
+		}
+		client := &slowRecordClient{fakeClient: newFakeClient(records), latency: 20 * time.Millisecond}
+		p, err := NewPorkbunProvider(zones, "KEY", "SECRET", false, logger, WithConcurrency(3, 2), WithGlobalConcurrency(2), WithClient(client))
+		assert.NoError(t, err)
+
+		// retrieving the records is not capped, changing them is
+		assert.NoError(t, p.ApplyChanges(context.TODO(), changes))
+		for _, zone := range zones {
+			assert.Len(t, client.records[zone], 2)
+		}
+		assert.Equal(t, 2, client.maxInFlight)
+	})
+
+	t.Run("errors of all zones", func(t *testing.T) {
+		server := newServer(t)
+		server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs("delete example.com 1"), Message: "failed"})
+		server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs("delete example.org 11"), Message: "failed"})
+		p, err := NewPorkbunProvider(zones, "KEY", "SECRET", false, logger, WithConcurrency(3, 1), WithBaseURL(server.URL))
+		assert.NoError(t, err)
+
+		err = p.ApplyChanges(context.TODO(), changes)
+		assert.ErrorContains(t, err, "zone example.com: unable to delete records")
+		assert.ErrorContains(t, err, "zone example.org: unable to delete records")
+		assert.NotContains(t, err.Error(), "example.net")
+
+		// the failing zones stop at their first error, the other zone is changed
+		assert.ElementsMatch(t, []string{
+			"delete example.com 1",
+			"delete example.org 11",
+			"delete example.net 21", "delete example.net 22", "create example.net new A 2.2.2.2 600", "create example.net new A 3.3.3.3 600",
+		}, server.MutationLog())
+	})
+}
+
 func testRecords(t *testing.T) {
 	domainFilter := []string{"example.com"}
 	var logger *slog.Logger
@@ -334,6 +1243,230 @@ func testRecords(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func testRecordsWithClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client := newFakeClient(map[string][]pb.Record{
+		"example.com": {
+			{ID: "1", Name: "example.com", Type: "NS", Content: "curitiba.ns.porkbun.com", TTL: "86400"},
+			{ID: "2", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+			{ID: "3", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+			{ID: "4", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+			{ID: "5", Name: "www.example.com", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=default", TTL: "600"},
+			{ID: "6", Name: "internal.example.com", Type: "A", Content: "10.0.0.1", TTL: "600"},
+		},
+		"example.org": {
+			{ID: "7", Name: "example.org", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		},
+		"example.net": {
+			{ID: "8", Name: "example.net", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		},
+	})
+	client.errs["retrieve example.org"] = &pb.ServerError{StatusCode: 404}
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.org"}, "KEY", "SECRET", false, logger,
+		WithClient(client),
+		WithDomainExclusions([]string{"internal.example.com"}),
+		WithManagedRecordTypes([]string{"A", "MX", "TXT"}))
+	assert.NoError(t, err)
+
+	// a zone that cannot be read is skipped, records of other zones, excluded
+	// domains and unmanaged types are not reported
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1", "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "heritage=external-dns,external-dns/owner=default"),
+	}, endpoints)
+	assert.Equal(t, []string{"ping", "retrieve example.com", "retrieve example.org"}, client.calls)
+
+	// failing to log in fails
+	client.errs["ping"] = pb.Status{Status: "ERROR", Message: "Invalid API key. (002)"}
+	_, err = p.Records(context.TODO())
+	assert.EqualError(t, err, "ERROR: Invalid API key. (002)")
+
+	// zone discovery through the client
+	delete(client.errs, "ping")
+	p, err = NewPorkbunProvider([]string{"example.net"}, "KEY", "SECRET", false, logger,
+		WithClient(client), WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+	endpoints, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.net", endpoint.RecordTypeA, 600, "1.1.1.1"),
+	}, endpoints)
+	assert.Contains(t, client.calls, "listDomains")
+
+	// a client that cannot list the domains is not bypassed for zone discovery
+	_, err = NewPorkbunProvider(nil, "KEY", "SECRET", false, logger,
+		WithClient(struct{ Client }{client}), WithZoneDiscovery(true, time.Hour))
+	assert.EqualError(t, err, "zone discovery requires a client with a ListDomains method")
+}
+
+func testApplyChangesWithClient(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	client := newFakeClient(map[string][]pb.Record{
+		"example.com": {
+			{ID: "1", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+			{ID: "2", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+			{ID: "3", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+			{ID: "4", Name: "old.example.com", Type: "CNAME", Content: "www.example.com", TTL: "600"},
+		},
+	})
+
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger,
+		WithClient(client), WithProtectedRecords([]string{"@ MX"}))
+	assert.NoError(t, err)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("api.example.com", endpoint.RecordTypeA, 600, "3.3.3.3"),
+			endpoint.NewEndpointWithTTL("_sip._tcp.example.com", endpoint.RecordTypeSRV, 600, "10 60 5060 sip.example.com"),
+			// outside of the domain filter
+			endpoint.NewEndpointWithTTL("www.example.org", endpoint.RecordTypeA, 600, "3.3.3.3"),
+		},
+		UpdateOld: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1", "2.2.2.2"),
+		},
+		UpdateNew: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 900, "1.1.1.1"),
+		},
+		Delete: []*endpoint.Endpoint{
+			endpoint.NewEndpointWithTTL("old.example.com", endpoint.RecordTypeCNAME, 600, "www.example.com"),
+			// protected
+			endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com"),
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"ping",
+		"retrieve example.com",
+		"delete example.com 4",
+		"delete example.com 3",
+		"create example.com api A 3.3.3.3",
+		"create example.com _sip._tcp SRV 60 5060 sip.example.com",
+		"edit example.com 2 www A 1.1.1.1",
+	}, client.calls)
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "2", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "900"},
+		{ID: "1001", Name: "api.example.com", Type: "A", Content: "3.3.3.3", TTL: "600"},
+		{ID: "1002", Name: "_sip._tcp.example.com", Type: "SRV", Content: "60 5060 sip.example.com", Prio: "10", TTL: "600"},
+	}, client.records["example.com"])
+
+	// the records reported afterwards are the desired ones
+	endpoints, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("example.com", endpoint.RecordTypeMX, 600, "10 mail.example.com"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 900, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("api.example.com", endpoint.RecordTypeA, 600, "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("_sip._tcp.example.com", endpoint.RecordTypeSRV, 600, "10 60 5060 sip.example.com"),
+	}, endpoints)
+}
+
+func testEndToEnd(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := porkbuntest.NewServer("KEY", "SECRET")
+	defer server.Close()
+	server.AddDomain("example.com",
+		pb.Record{ID: "1", Name: "", Type: "NS", Content: "curitiba.ns.porkbun.com", TTL: "86400"},
+		pb.Record{ID: "2", Name: "", Type: "MX", Content: "mail.example.com", Prio: "10"},
+		pb.Record{ID: "3", Name: "www", Type: "A", Content: "1.1.1.1"},
+		pb.Record{ID: "4", Name: "www", Type: "TXT", Content: "heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/www"},
+	)
+	server.AddDomain("example.org")
+
+	_, err := NewPorkbunProvider(nil, "KEY", "SECRET", false, logger, WithZoneDiscovery(true, time.Hour), WithBaseURL("not a url"))
+	assert.Error(t, err)
+
+	p, err := NewPorkbunProvider(nil, "KEY", "SECRET", false, logger,
+		WithBaseURL(server.URL),
+		WithZoneDiscovery(true, time.Hour),
+		WithManagedRecordTypes([]string{"A", "AAAA", "CNAME", "TXT"}),
+		WithRetries(2, time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+
+	// a rate limited retrieval is retried
+	server.Fail(porkbuntest.Fault{Match: porkbuntest.RequestIs("retrieve example.com"), StatusCode: 503})
+
+	current, err := p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "1.1.1.1"),
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeTXT, 600, "heritage=external-dns,external-dns/owner=default,external-dns/resource=service/default/www"),
+	}, current)
+
+	desired, err := p.AdjustEndpoints([]*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 300, "2.2.2.2", "3.3.3.3"),
+		endpoint.NewEndpoint("api.example.org.", endpoint.RecordTypeCNAME, "www.example.com"),
+	})
+	assert.NoError(t, err)
+
+	err = p.ApplyChanges(context.TODO(), &plan.Changes{
+		Create:    desired[1:],
+		UpdateOld: current[:1],
+		UpdateNew: desired[:1],
+		Delete:    current[1:],
+	})
+	assert.NoError(t, err)
+
+	// The zones are changed in no particular order, so the IDs of the created
+	// records are not compared.
+	withoutNewIDs := func(records []pb.Record) []pb.Record {
+		for i := range records {
+			if id, _ := strconv.Atoi(records[i].ID); id > 100 {
+				records[i].ID = ""
+			}
+		}
+		return records
+	}
+	assert.Equal(t, []pb.Record{
+		{ID: "1", Name: "example.com", Type: "NS", Content: "curitiba.ns.porkbun.com", TTL: "86400"},
+		{ID: "2", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "3", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		{Name: "www.example.com", Type: "A", Content: "3.3.3.3", TTL: "600"},
+	}, withoutNewIDs(server.Records("example.com")))
+	assert.Equal(t, []pb.Record{
+		{Name: "api.example.org", Type: "CNAME", Content: "www.example.com", TTL: "600"},
+	}, withoutNewIDs(server.Records("example.org")))
+
+	// the next sync finds the desired targets, the unset TTL reported as Porkbun's minimum
+	current, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", endpoint.RecordTypeA, 600, "2.2.2.2", "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("api.example.org", endpoint.RecordTypeCNAME, 600, "www.example.com"),
+	}, current)
+}
+
+func testRecordsToEndpoints(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	records := []pb.Record{
+		{ID: "1", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "600"},
+		{ID: "2", Name: "www.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+		{ID: "3", Name: "www.example.com", Type: "A", Content: "3.3.3.3", TTL: "600"},
+		{ID: "4", Name: "www.example.com", Type: "TXT", Content: "v=1", TTL: "600"},
+		{ID: "5", Name: "ttl.example.com", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+		{ID: "6", Name: "ttl.example.com", Type: "A", Content: "2.2.2.2", TTL: "900"},
+		{ID: "7", Name: "example.com", Type: "A", Content: "4.4.4.4", TTL: "invalid"},
+	}
+
+	expected := []*endpoint.Endpoint{
+		endpoint.NewEndpointWithTTL("www.example.com", "A", 600, "1.1.1.1", "2.2.2.2", "3.3.3.3"),
+		endpoint.NewEndpointWithTTL("www.example.com", "TXT", 600, "v=1"),
+		endpoint.NewEndpointWithTTL("ttl.example.com", "A", 900, "1.1.1.1", "2.2.2.2"),
+		endpoint.NewEndpointWithTTL("example.com", "A", 600, "4.4.4.4"),
+	}
+
+	assert.Equal(t, expected, recordsToEndpoints(logger, "example.com", records, false))
+}
+
 func testRemoveNoopTXTUpdates(t *testing.T) {
 	oldNoop := &endpoint.Endpoint{
 		DNSName:    "txt-noop.example.com",
@@ -378,6 +1511,34 @@ func testRemoveNoopTXTUpdates(t *testing.T) {
 		RecordTTL:  300,
 	}
 
+	// second target changed, keep
+	oldMulti := &endpoint.Endpoint{
+		DNSName:    "txt-multi.example.com",
+		RecordType: endpoint.RecordTypeTXT,
+		Targets:    endpoint.Targets{"x", "y"},
+		RecordTTL:  300,
+	}
+	newMulti := &endpoint.Endpoint{
+		DNSName:    "txt-multi.example.com",
+		RecordType: endpoint.RecordTypeTXT,
+		Targets:    endpoint.Targets{"x", "z"},
+		RecordTTL:  300,
+	}
+
+	// same targets in another order, remove
+	oldReordered := &endpoint.Endpoint{
+		DNSName:    "txt-reordered.example.com",
+		RecordType: endpoint.RecordTypeTXT,
+		Targets:    endpoint.Targets{"x", "y"},
+		RecordTTL:  300,
+	}
+	newReordered := &endpoint.Endpoint{
+		DNSName:    "txt-reordered.example.com",
+		RecordType: endpoint.RecordTypeTXT,
+		Targets:    endpoint.Targets{"y", "x"},
+		RecordTTL:  300,
+	}
+
 	// no old, keep
 	newOrphan := &endpoint.Endpoint{
 		DNSName:    "txt-orphan.example.com",
@@ -405,21 +1566,25 @@ func testRemoveNoopTXTUpdates(t *testing.T) {
 			oldNoop,
 			oldTTL,
 			oldTarget,
+			oldMulti,
+			oldReordered,
 			oldA,
 		},
 		UpdateNew: []*endpoint.Endpoint{
-			newNoop,   // remove
-			newTTL,    // keep
-			newTarget, // keep
-			newOrphan, // keep
-			newA,      // keep
+			newNoop,      // remove
+			newTTL,       // keep
+			newTarget,    // keep
+			newMulti,     // keep
+			newReordered, // remove
+			newOrphan,    // keep
+			newA,         // keep
 		},
 	}
 
 	removeNoopTXTUpdates(changes)
 
-	if len(changes.UpdateNew) != 4 {
-		t.Fatalf("expected 4 UpdateNew entries after removeNoopTXTUpdates, got %d", len(changes.UpdateNew))
+	if len(changes.UpdateNew) != 5 {
+		t.Fatalf("expected 5 UpdateNew entries after removeNoopTXTUpdates, got %d", len(changes.UpdateNew))
 	}
 
 	hasEndpoint := func(name, recordType string) bool {
@@ -443,6 +1608,15 @@ func testRemoveNoopTXTUpdates(t *testing.T) {
 	if !hasEndpoint("txt-target.example.com", endpoint.RecordTypeTXT) {
 		t.Errorf("expected txt-target.example.com TXT to remain")
 	}
+	if !hasEndpoint("txt-multi.example.com", endpoint.RecordTypeTXT) {
+		t.Errorf("expected txt-multi.example.com TXT to remain")
+	}
+	if hasEndpoint("txt-reordered.example.com", endpoint.RecordTypeTXT) {
+		t.Errorf("expected txt-reordered.example.com TXT to be removed as no-op, but it is still present")
+	}
+	if newReordered.Targets[0] != "y" {
+		t.Errorf("expected the targets of the update to be left in their order")
+	}
 	if !hasEndpoint("txt-orphan.example.com", endpoint.RecordTypeTXT) {
 		t.Errorf("expected txt-orphan.example.com TXT to remain")
 	}
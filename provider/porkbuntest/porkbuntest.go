@@ -0,0 +1,411 @@
+// Package porkbuntest provides an in-memory fake of the Porkbun JSON API for tests.
+//
+// The fake serves the calls the webhook makes: ping, listing the domains of the
+// account, and retrieving, creating, editing and deleting DNS records. Every domain
+// keeps its own records, record IDs are assigned like Porkbun does and any request
+// can be made to fail with a scripted Fault. Records are stored and retrieved with
+// fully qualified names, as Porkbun reports them.
+package porkbuntest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pb "github.com/nrdcg/porkbun"
+)
+
+// The operations of the API, as found in Request.Operation.
+const (
+	OperationPing     = "ping"
+	OperationListAll  = "listAll"
+	OperationRetrieve = "retrieve"
+	OperationCreate   = "create"
+	OperationEdit     = "edit"
+	OperationDelete   = "delete"
+)
+
+// listAllPageSize is the number of domains returned per domain listing call.
+const listAllPageSize = 1000
+
+// minTTL is the lowest TTL Porkbun stores, it is also used for records created
+// without a TTL.
+const minTTL = 600
+
+// Request is a request received by the Server.
+type Request struct {
+	Operation string
+	Domain    string
+	// ID is the ID of the edited or deleted record.
+	ID int
+	// Record is the record sent for creating or editing, with the name relative to
+	// the domain.
+	Record pb.Record
+}
+
+// String returns a compact form of the request, e.g. "create example.com www A
+// 1.1.1.1 600" or "delete example.com 12". The apex is written as "@".
+func (r Request) String() string {
+	parts := []string{r.Operation}
+	if r.Domain != "" {
+		parts = append(parts, r.Domain)
+	}
+	if r.Operation == OperationEdit || r.Operation == OperationDelete {
+		parts = append(parts, strconv.Itoa(r.ID))
+	}
+	if r.Operation == OperationCreate || r.Operation == OperationEdit {
+		name := r.Record.Name
+		if name == "" {
+			name = "@"
+		}
+		parts = append(parts, name, r.Record.Type)
+		if r.Record.Prio != "" {
+			parts = append(parts, r.Record.Prio)
+		}
+		parts = append(parts, r.Record.Content, r.Record.TTL)
+	}
+	return strings.Join(parts, " ")
+}
+
+// DefaultErrorStatusCode is the HTTP status the Server answers failed requests with,
+// together with an ERROR status and a message in the response body. Porkbun is
+// assumed to answer invalid requests, e.g. bad credentials or unknown record IDs,
+// with 400 Bad Request, which the porkbun client returns as a *porkbun.ServerError
+// holding the response body.
+const DefaultErrorStatusCode = http.StatusBadRequest
+
+// Fault makes matching requests fail.
+type Fault struct {
+	// Match selects the requests to fail, every request if nil.
+	Match func(r Request) bool
+	// StatusCode is the HTTP status of the response, the error status code of the
+	// Server if zero. The response body holds an ERROR status with the message.
+	StatusCode int
+	// Message is the error message of the response.
+	Message string
+	// Times is how many matching requests fail. Zero fails the next matching
+	// request only, a negative number every matching request.
+	Times int
+	// Applied makes the request take effect before it fails, as if its answer was
+	// lost on the way back.
+	Applied bool
+}
+
+// RequestIs matches the requests whose String form equals s.
+func RequestIs(s string) func(r Request) bool {
+	return func(r Request) bool {
+		return r.String() == s
+	}
+}
+
+// Server is a fake Porkbun API. Point a client at its URL, e.g. by setting the
+// BaseURL of a porkbun.Client.
+type Server struct {
+	*httptest.Server
+
+	apiKey       string
+	secretAPIKey string
+
+	mu              sync.Mutex
+	errorStatusCode int
+	domains         map[string][]pb.Record
+	nextID          int
+	faults          []*Fault
+	requests        []Request
+	latency         time.Duration
+	inFlight        int
+	maxInFlight     int
+}
+
+// NewServer starts a fake Porkbun API accepting the given credentials. The server
+// has to be closed by the caller.
+func NewServer(apiKey string, secretAPIKey string) *Server {
+	s := &Server{
+		apiKey:          apiKey,
+		secretAPIKey:    secretAPIKey,
+		errorStatusCode: DefaultErrorStatusCode,
+		domains:         make(map[string][]pb.Record),
+		nextID:          100,
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// AddDomain adds a domain to the account with the given records. Record names are
+// relative to the domain, "" being the apex. Records without an ID are assigned one.
+func (s *Server) AddDomain(domain string, records ...pb.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.domains[domain] = make([]pb.Record, 0, len(records))
+	for _, rec := range records {
+		s.domains[domain] = append(s.domains[domain], s.store(domain, rec))
+	}
+}
+
+// Records returns the records of the domain, with fully qualified names.
+func (s *Server) Records(domain string) []pb.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]pb.Record(nil), s.domains[domain]...)
+}
+
+// Requests returns the requests received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// MutationLog returns the String form of the create, edit and delete requests
+// received so far, in order.
+func (s *Server) MutationLog() []string {
+	var log []string
+	for _, r := range s.Requests() {
+		switch r.Operation {
+		case OperationCreate, OperationEdit, OperationDelete:
+			log = append(log, r.String())
+		}
+	}
+	return log
+}
+
+// Fail makes the requests matching the fault fail. Faults are checked in the order
+// they were added.
+func (s *Server) Fail(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// SetErrorStatusCode sets the HTTP status failed requests are answered with, e.g.
+// 200 to check the handling of errors reported in successful answers.
+func (s *Server) SetErrorStatusCode(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorStatusCode = code
+}
+
+// SetLatency delays every response by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// MaxConcurrentRequests returns the highest number of requests that were handled at
+// the same time.
+func (s *Server) MaxConcurrentRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight
+}
+
+// store returns the record as stored for the domain, with a fully qualified name,
+// an ID and a TTL of at least minTTL.
+func (s *Server) store(domain string, rec pb.Record) pb.Record {
+	if rec.ID == "" {
+		s.nextID++
+		rec.ID = strconv.Itoa(s.nextID)
+	}
+	if rec.Name == "" {
+		rec.Name = domain
+	} else {
+		rec.Name += "." + domain
+	}
+	if ttl, err := strconv.Atoi(rec.TTL); err != nil || ttl < minTTL {
+		rec.TTL = strconv.Itoa(minTTL)
+	}
+	return rec
+}
+
+// apiRequest is the body of every request.
+type apiRequest struct {
+	APIKey       string `json:"apikey"`
+	SecretAPIKey string `json:"secretapikey"`
+	Start        string `json:"start"`
+	pb.Record
+}
+
+type status struct {
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var body apiRequest
+	if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&body) != nil {
+		writeJSON(w, http.StatusBadRequest, status{Status: "ERROR", Message: "Invalid request."})
+		return
+	}
+
+	req, ok := parseRequest(r.URL.Path, body.Record)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, status{Status: "ERROR", Message: "Not found."})
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	latency := s.latency
+	fault := s.fault(req)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(latency)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if fault != nil {
+		if fault.Applied {
+			s.handle(req, body)
+		}
+		code := fault.StatusCode
+		if code == 0 {
+			code = s.errorStatusCode
+		}
+		writeJSON(w, code, status{Status: "ERROR", Message: fault.Message})
+		return
+	}
+
+	code, resp := s.handle(req, body)
+	writeJSON(w, code, resp)
+}
+
+// handle carries out a request and returns the HTTP status and body of the answer.
+func (s *Server) handle(req Request, body apiRequest) (int, any) {
+	if body.APIKey != s.apiKey || body.SecretAPIKey != s.secretAPIKey {
+		return s.errorStatusCode, status{Status: "ERROR", Message: "Invalid API key. (002)"}
+	}
+
+	if req.Operation == OperationPing {
+		return http.StatusOK, map[string]string{"status": "SUCCESS", "yourIp": "127.0.0.1"}
+	}
+	if req.Operation == OperationListAll {
+		return http.StatusOK, s.listAll(body.Start)
+	}
+
+	records, ok := s.domains[req.Domain]
+	if !ok {
+		return s.errorStatusCode, status{Status: "ERROR", Message: "Invalid domain."}
+	}
+
+	switch req.Operation {
+	case OperationRetrieve:
+		return http.StatusOK, map[string]any{"status": "SUCCESS", "records": records}
+	case OperationCreate:
+		if req.Record.Type == "" || req.Record.Content == "" {
+			return s.errorStatusCode, status{Status: "ERROR", Message: "Type and content are required."}
+		}
+		rec := req.Record
+		rec.ID = ""
+		rec = s.store(req.Domain, rec)
+		s.domains[req.Domain] = append(records, rec)
+		id, _ := strconv.Atoi(rec.ID)
+		return http.StatusOK, map[string]any{"status": "SUCCESS", "id": id}
+	default:
+		i := recordIndex(records, req.ID)
+		if i < 0 {
+			return s.errorStatusCode, status{Status: "ERROR", Message: "Invalid record ID."}
+		}
+		if req.Operation == OperationEdit {
+			rec := req.Record
+			rec.ID = records[i].ID
+			records[i] = s.store(req.Domain, rec)
+		} else {
+			s.domains[req.Domain] = append(records[:i:i], records[i+1:]...)
+		}
+		return http.StatusOK, status{Status: "SUCCESS"}
+	}
+}
+
+// fault returns the first fault matching the request and uses it up, or nil.
+func (s *Server) fault(req Request) *Fault {
+	for i, f := range s.faults {
+		if f.Match != nil && !f.Match(req) {
+			continue
+		}
+		if f.Times == 0 || f.Times == 1 {
+			s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+		} else if f.Times > 1 {
+			f.Times--
+		}
+		return f
+	}
+	return nil
+}
+
+// listAll returns the answer to a domain listing call starting at startParam.
+func (s *Server) listAll(startParam string) map[string]any {
+	names := make([]string, 0, len(s.domains))
+	for domain := range s.domains {
+		names = append(names, domain)
+	}
+	sort.Strings(names)
+
+	start, _ := strconv.Atoi(startParam)
+	domains := make([]map[string]string, 0, listAllPageSize)
+	for i := start; i >= 0 && i < len(names) && i < start+listAllPageSize; i++ {
+		domains = append(domains, map[string]string{"domain": names[i], "status": "ACTIVE"})
+	}
+	return map[string]any{"status": "SUCCESS", "domains": domains}
+}
+
+// parseRequest maps the path of a request to the API operation.
+func parseRequest(path string, record pb.Record) (Request, bool) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "ping":
+		return Request{Operation: OperationPing}, true
+	case len(parts) == 2 && parts[0] == "domain" && parts[1] == "listAll":
+		return Request{Operation: OperationListAll}, true
+	case len(parts) < 3 || parts[0] != "dns":
+		return Request{}, false
+	}
+
+	req := Request{Operation: parts[1], Domain: parts[2]}
+	switch {
+	case len(parts) == 3 && req.Operation == OperationRetrieve:
+	case len(parts) == 3 && req.Operation == OperationCreate:
+		req.Record = record
+	case len(parts) == 4 && (req.Operation == OperationEdit || req.Operation == OperationDelete):
+		id, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return Request{}, false
+		}
+		req.ID = id
+		if req.Operation == OperationEdit {
+			req.Record = record
+		}
+	default:
+		return Request{}, false
+	}
+	return req, true
+}
+
+func recordIndex(records []pb.Record, id int) int {
+	for i, rec := range records {
+		if rec.ID == strconv.Itoa(id) {
+			return i
+		}
+	}
+	return -1
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
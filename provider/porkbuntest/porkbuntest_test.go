@@ -0,0 +1,169 @@
+package porkbuntest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	pb "github.com/nrdcg/porkbun"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T, s *Server, apiKey string) *pb.Client {
+	client := pb.New("SECRET", apiKey)
+	var err error
+	client.BaseURL, err = url.Parse(s.URL)
+	assert.NoError(t, err)
+	return client
+}
+
+// assertAPIError asserts that err is the porkbun client's error for an answer with
+// the given HTTP status and an ERROR status with the message.
+func assertAPIError(t *testing.T, err error, code int, message string) {
+	var serverErr *pb.ServerError
+	if assert.ErrorAs(t, err, &serverErr) {
+		assert.Equal(t, code, serverErr.StatusCode)
+		assert.JSONEq(t, fmt.Sprintf(`{"status":"ERROR","message":%q}`, message), serverErr.Message)
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := NewServer("KEY", "SECRET")
+	defer s.Close()
+	s.AddDomain("example.com",
+		pb.Record{Name: "", Type: "MX", Content: "mail.example.com", Prio: "10"},
+		pb.Record{ID: "7", Name: "www", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+	)
+
+	ctx := context.TODO()
+	client := newClient(t, s, "KEY")
+
+	ip, err := client.Ping(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip)
+
+	_, err = newClient(t, s, "WRONG").Ping(ctx)
+	assertAPIError(t, err, http.StatusBadRequest, "Invalid API key. (002)")
+
+	records, err := client.RetrieveRecords(ctx, "example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []pb.Record{
+		{ID: "101", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10", TTL: "600"},
+		{ID: "7", Name: "www.example.com", Type: "A", Content: "1.1.1.1", TTL: "3600"},
+	}, records)
+
+	_, err = client.RetrieveRecords(ctx, "example.org")
+	assertAPIError(t, err, http.StatusBadRequest, "Invalid domain.")
+
+	id, err := client.CreateRecord(ctx, "example.com", pb.Record{Name: "api", Type: "A", Content: "2.2.2.2", TTL: "60"})
+	assert.NoError(t, err)
+	assert.Equal(t, 102, id)
+
+	assert.NoError(t, client.EditRecord(ctx, "example.com", 7, pb.Record{Name: "www", Type: "A", Content: "3.3.3.3", TTL: "600"}))
+	assert.NoError(t, client.DeleteRecord(ctx, "example.com", 101))
+	assertAPIError(t, client.DeleteRecord(ctx, "example.com", 101), http.StatusBadRequest, "Invalid record ID.")
+
+	assert.Equal(t, []pb.Record{
+		{ID: "7", Name: "www.example.com", Type: "A", Content: "3.3.3.3", TTL: "600"},
+		{ID: "102", Name: "api.example.com", Type: "A", Content: "2.2.2.2", TTL: "600"},
+	}, s.Records("example.com"))
+
+	assert.Equal(t, []string{
+		"create example.com api A 2.2.2.2 60",
+		"edit example.com 7 www A 3.3.3.3 600",
+		"delete example.com 101",
+		"delete example.com 101",
+	}, s.MutationLog())
+	assert.Equal(t, Request{Operation: OperationRetrieve, Domain: "example.org"}, s.Requests()[3])
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer("KEY", "SECRET")
+	defer s.Close()
+	s.AddDomain("example.com")
+
+	ctx := context.TODO()
+	client := newClient(t, s, "KEY")
+
+	// once by default
+	s.Fail(Fault{Match: RequestIs("retrieve example.com"), StatusCode: http.StatusServiceUnavailable})
+	_, err := client.RetrieveRecords(ctx, "example.com")
+	var serverErr *pb.ServerError
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, http.StatusServiceUnavailable, serverErr.StatusCode)
+	_, err = client.RetrieveRecords(ctx, "example.com")
+	assert.NoError(t, err)
+
+	// a number of times, with an API error
+	s.Fail(Fault{Match: RequestIs("create example.com @ TXT v=1 600"), Message: "Rate limit exceeded", Times: 2})
+	for range 2 {
+		_, err = client.CreateRecord(ctx, "example.com", pb.Record{Type: "TXT", Content: "v=1", TTL: "600"})
+		assertAPIError(t, err, http.StatusBadRequest, "Rate limit exceeded")
+	}
+	_, err = client.CreateRecord(ctx, "example.com", pb.Record{Type: "TXT", Content: "v=1", TTL: "600"})
+	assert.NoError(t, err)
+
+	// every matching request
+	s.Fail(Fault{Match: func(r Request) bool { return r.Operation == OperationPing }, StatusCode: http.StatusInternalServerError, Times: -1})
+	for range 3 {
+		_, err = client.Ping(ctx)
+		assert.ErrorAs(t, err, &serverErr)
+	}
+	_, err = client.RetrieveRecords(ctx, "example.com")
+	assert.NoError(t, err)
+
+	// a request that takes effect before its answer is lost
+	s.AddDomain("example.org", pb.Record{ID: "1", Name: "www", Type: "A", Content: "1.1.1.1"})
+	s.Fail(Fault{Match: RequestIs("delete example.org 1"), StatusCode: http.StatusGatewayTimeout, Applied: true})
+	assert.ErrorAs(t, client.DeleteRecord(ctx, "example.org", 1), &serverErr)
+	assert.Empty(t, s.Records("example.org"))
+}
+
+func TestServerErrorStatusCode(t *testing.T) {
+	s := NewServer("KEY", "SECRET")
+	defer s.Close()
+	s.SetErrorStatusCode(http.StatusOK)
+
+	// errors in successful answers are returned as a status by the client
+	_, err := newClient(t, s, "KEY").RetrieveRecords(context.TODO(), "example.com")
+	assert.Equal(t, pb.Status{Status: "ERROR", Message: "Invalid domain."}, err)
+}
+
+func TestServerListAll(t *testing.T) {
+	s := NewServer("KEY", "SECRET")
+	defer s.Close()
+	for i := range listAllPageSize + 2 {
+		s.AddDomain(fmt.Sprintf("example%04d.com", i))
+	}
+
+	list := func(start int) []string {
+		body, _ := json.Marshal(map[string]string{"apikey": "KEY", "secretapikey": "SECRET", "start": fmt.Sprint(start)})
+		resp, err := http.Post(s.URL+"/domain/listAll", "application/json", bytes.NewReader(body))
+		assert.NoError(t, err)
+		defer func() { _ = resp.Body.Close() }()
+
+		var listResp struct {
+			Status  string `json:"status"`
+			Domains []struct {
+				Domain string `json:"domain"`
+			} `json:"domains"`
+		}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&listResp))
+		assert.Equal(t, "SUCCESS", listResp.Status)
+
+		domains := make([]string, 0, len(listResp.Domains))
+		for _, d := range listResp.Domains {
+			domains = append(domains, d.Domain)
+		}
+		return domains
+	}
+
+	first := list(0)
+	assert.Len(t, first, listAllPageSize)
+	assert.Equal(t, "example0000.com", first[0])
+	assert.Equal(t, []string{"example1000.com", "example1001.com"}, list(listAllPageSize))
+}
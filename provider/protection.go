@@ -0,0 +1,108 @@
+package porkbun
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/dnsname"
+	pb "github.com/nrdcg/porkbun"
+)
+
+// protectionRule protects the records whose name relative to the zone matches a glob
+// pattern, "@" being the apex, and whose type matches, if a type is given.
+type protectionRule struct {
+	pattern    string
+	recordType string
+}
+
+// parseProtectionRule parses a rule of the form "<pattern> [<type>]", e.g. "@ MX",
+// "_dmarc TXT" or "mail*".
+func parseProtectionRule(rule string) (protectionRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) == 0 || len(fields) > 2 {
+		return protectionRule{}, fmt.Errorf("invalid protected record %q, expected '<name pattern> [<type>]'", rule)
+	}
+
+	r := protectionRule{pattern: dnsname.Normalize(fields[0])}
+	if r.pattern == "" {
+		return protectionRule{}, fmt.Errorf("invalid protected record %q, use @ for the apex", rule)
+	}
+	if _, err := path.Match(r.pattern, ""); err != nil {
+		return protectionRule{}, fmt.Errorf("invalid protected record %q: %w", rule, err)
+	}
+	if len(fields) == 2 {
+		r.recordType = strings.ToUpper(fields[1])
+		if !supportedRecordTypes[r.recordType] {
+			return protectionRule{}, fmt.Errorf("invalid protected record %q, record type %s is not supported", rule, fields[1])
+		}
+	}
+	return r, nil
+}
+
+// parseProtectionRules parses a list of rules.
+func parseProtectionRules(rules []string) ([]protectionRule, error) {
+	parsed := make([]protectionRule, 0, len(rules))
+	for _, rule := range rules {
+		r, err := parseProtectionRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// String returns the rule in the form it is parsed from.
+func (r protectionRule) String() string {
+	if r.recordType == "" {
+		return r.pattern
+	}
+	return r.pattern + " " + r.recordType
+}
+
+// matches reports whether the rule protects a record with the name relative to the
+// zone, which is empty for the apex, and the type.
+func (r protectionRule) matches(name string, recordType string) bool {
+	if name == "" {
+		name = "@"
+	}
+	if r.recordType != "" && r.recordType != recordType {
+		return false
+	}
+	matched, _ := path.Match(r.pattern, name)
+	return matched
+}
+
+// refuseProtected returns the records that are not protected by the global or the
+// zone's protection rules. Every refused change is logged and counted.
+func (p *PorkbunProvider) refuseProtected(zone string, action string, records []pb.Record) []pb.Record {
+	rules := p.protectionRules
+	if zoneRules := p.zoneProtectionRules[dnsname.Normalize(zone)]; len(zoneRules) > 0 {
+		rules = append(rules[:len(rules):len(rules)], zoneRules...)
+	}
+	if len(rules) == 0 {
+		return records
+	}
+
+	allowed := make([]pb.Record, 0, len(records))
+	for _, record := range records {
+		name, _ := dnsname.ToPorkbun(dnsname.FromPorkbun(record.Name, zone), zone)
+
+		var protectedBy *protectionRule
+		for i := range rules {
+			if rules[i].matches(name, record.Type) {
+				protectedBy = &rules[i]
+				break
+			}
+		}
+		if protectedBy == nil {
+			allowed = append(allowed, record)
+			continue
+		}
+
+		p.logger.Warn("refusing change to protected record", "action", action, "zone", zone, "name", record.Name, "type", record.Type, "content", record.Content, "rule", protectedBy.String())
+		protectedChangesRefused.WithLabelValues(zone, action, record.Type).Inc()
+	}
+	return allowed
+}
@@ -0,0 +1,121 @@
+package porkbun
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	pb "github.com/nrdcg/porkbun"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseProtectionRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		want    protectionRule
+		wantErr bool
+	}{
+		{name: "apex with type", rule: "@ MX", want: protectionRule{pattern: "@", recordType: "MX"}},
+		{name: "name with type", rule: "_dmarc TXT", want: protectionRule{pattern: "_dmarc", recordType: "TXT"}},
+		{name: "name only", rule: "mail", want: protectionRule{pattern: "mail"}},
+		{name: "glob", rule: "_domainkey.* txt", want: protectionRule{pattern: "_domainkey.*", recordType: "TXT"}},
+		{name: "mixed case and whitespace", rule: "  Mail   a ", want: protectionRule{pattern: "mail", recordType: "A"}},
+		{name: "empty", rule: "", wantErr: true},
+		{name: "too many fields", rule: "@ MX TXT", wantErr: true},
+		{name: "unsupported type", rule: "@ PTR", wantErr: true},
+		{name: "invalid glob", rule: "[mail", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProtectionRule(tt.rule)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProtectionRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule       string
+		name       string
+		recordType string
+		want       bool
+	}{
+		{rule: "@ MX", name: "", recordType: "MX", want: true},
+		{rule: "@ MX", name: "", recordType: "TXT", want: false},
+		{rule: "@ MX", name: "mail", recordType: "MX", want: false},
+		{rule: "@", name: "", recordType: "TXT", want: true},
+		{rule: "_dmarc TXT", name: "_dmarc", recordType: "TXT", want: true},
+		{rule: "_dmarc TXT", name: "_dmarc.sub", recordType: "TXT", want: false},
+		{rule: "*._domainkey TXT", name: "selector1._domainkey", recordType: "TXT", want: true},
+		{rule: "*._domainkey TXT", name: "_domainkey", recordType: "TXT", want: false},
+		{rule: "mail*", name: "mail2", recordType: "A", want: true},
+		{rule: "*", name: "www", recordType: "A", want: true},
+		{rule: "*", name: "", recordType: "A", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.rule+"/"+tt.name+"/"+tt.recordType, func(t *testing.T) {
+			rule, err := parseProtectionRule(tt.rule)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, rule.matches(tt.name, tt.recordType))
+		})
+	}
+}
+
+func TestRefuseProtected(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	config := &Config{Zones: map[string]ZoneConfig{
+		"example.com": {ProtectedRecords: []string{"mail"}},
+	}}
+	assert.NoError(t, config.normalize())
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.org"}, "KEY", "PASSWORD", false, logger,
+		WithConfig(config), WithProtectedRecords([]string{"@ MX", "_dmarc TXT"}))
+	assert.NoError(t, err)
+
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", false, logger, WithProtectedRecords([]string{"@ PTR"}))
+	assert.Error(t, err)
+
+	// invalid zone rules of a config that was not loaded from a file fail as well
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "PASSWORD", false, logger,
+		WithConfig(&Config{Zones: map[string]ZoneConfig{"example.com": {ProtectedRecords: []string{"@ PTR"}}}}))
+	assert.EqualError(t, err, `zone example.com: invalid protected record "@ PTR", record type PTR is not supported`)
+
+	before := testutil.ToFloat64(protectedChangesRefused.WithLabelValues("example.com", "delete", "MX"))
+
+	records := []pb.Record{
+		// relative names as sent for creates and updates
+		{Name: "", Type: "MX", Content: "mail.example.com", Prio: "10"},
+		{Name: "", Type: "A", Content: "1.1.1.1"},
+		{Name: "_dmarc", Type: "TXT", Content: "v=DMARC1; p=reject"},
+		{Name: "mail", Type: "A", Content: "1.1.1.1"},
+		{Name: "www", Type: "A", Content: "1.1.1.1"},
+		// fully qualified names as retrieved for deletes
+		{ID: "1", Name: "example.com", Type: "MX", Content: "mail.example.com", Prio: "10"},
+		{ID: "2", Name: "_dmarc.example.com", Type: "A", Content: "1.1.1.1"},
+	}
+
+	assert.Equal(t, []pb.Record{
+		{Name: "", Type: "A", Content: "1.1.1.1"},
+		{Name: "www", Type: "A", Content: "1.1.1.1"},
+		{ID: "2", Name: "_dmarc.example.com", Type: "A", Content: "1.1.1.1"},
+	}, p.refuseProtected("example.com", "delete", records))
+	assert.Equal(t, before+2, testutil.ToFloat64(protectedChangesRefused.WithLabelValues("example.com", "delete", "MX")))
+
+	// the zone rules only apply to their zone
+	assert.Equal(t, []pb.Record{
+		{Name: "mail", Type: "A", Content: "1.1.1.1"},
+	}, p.refuseProtected("example.org", "create", []pb.Record{
+		{Name: "", Type: "MX", Content: "mail.example.org", Prio: "10"},
+		{Name: "mail", Type: "A", Content: "1.1.1.1"},
+	}))
+}
@@ -0,0 +1,148 @@
+package porkbun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	pb "github.com/nrdcg/porkbun"
+)
+
+// Reasons for retrying a Porkbun API call, used as metric labels.
+const (
+	retryReasonRateLimited = "rate_limited"
+	retryReasonServerError = "server_error"
+	retryReasonNetwork     = "network"
+)
+
+// rateLimitMessages are parts of the messages Porkbun answers rate limited calls with.
+var rateLimitMessages = []string{"rate limit", "too many", "try again"}
+
+// retryPolicy is how often and how long to wait before failed Porkbun API calls are
+// tried again.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+}
+
+// defaultRetryPolicy retries a call three times, waiting about one, two and four
+// seconds.
+var defaultRetryPolicy = retryPolicy{maxRetries: 3, baseDelay: time.Second, maxDelay: 30 * time.Second}
+
+// backoff returns how long to wait before the retry following the given attempt,
+// starting at attempt 0. The delay doubles with every attempt up to maxDelay and is
+// reduced by a random jitter of up to half of it, so that concurrent calls do not
+// retry in lockstep.
+func (r retryPolicy) backoff(attempt int) time.Duration {
+	delay := r.baseDelay
+	for i := 0; i < attempt && delay < r.maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, r.maxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay - rand.N(delay/2+1)
+}
+
+// retryReason classifies an error returned by the Porkbun client. It returns the
+// reason for retrying the call, or an empty string if the error is permanent.
+func retryReason(err error) string {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ""
+	}
+
+	var serverErr *pb.ServerError
+	if errors.As(err, &serverErr) {
+		switch serverErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			// Porkbun answers rate limited calls with 503 as well.
+			return retryReasonRateLimited
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+			return retryReasonServerError
+		}
+	}
+
+	if status, ok := porkbunStatus(err); ok {
+		message := strings.ToLower(status.Message)
+		for _, m := range rateLimitMessages {
+			if strings.Contains(message, m) {
+				return retryReasonRateLimited
+			}
+		}
+		return ""
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return retryReasonNetwork
+	}
+	return ""
+}
+
+// porkbunStatus returns the status Porkbun answered a failed call with. The Porkbun
+// client returns the status as a pb.Status for answers with HTTP status 200, and as
+// the message of a *pb.ServerError holding the response body for other answers, e.g.
+// 400 for invalid requests.
+func porkbunStatus(err error) (pb.Status, bool) {
+	var status pb.Status
+	if errors.As(err, &status) {
+		return status, true
+	}
+
+	var serverErr *pb.ServerError
+	if errors.As(err, &serverErr) {
+		if json.Unmarshal([]byte(serverErr.Message), &status) == nil && status.Status != "" {
+			return status, true
+		}
+	}
+	return pb.Status{}, false
+}
+
+// withRetries calls call until it succeeds, fails permanently or the retries of the
+// policy are used up. Calls that are not idempotent, i.e. creating a record, are
+// only retried if Porkbun rate limited them, as they may have taken effect otherwise.
+// No retry is attempted if the context ends before it would be made.
+func (p *PorkbunProvider) withRetries(ctx context.Context, operation string, idempotent bool, call func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil {
+			return nil
+		}
+
+		reason := retryReason(err)
+		if reason == "" || (!idempotent && reason != retryReasonRateLimited) {
+			return err
+		}
+		if attempt >= p.retryPolicy.maxRetries {
+			if attempt > 0 {
+				apiRetriesExhausted.WithLabelValues(operation).Inc()
+				p.logger.Warn("giving up on Porkbun API call", "operation", operation, "retries", attempt, "error", err)
+			}
+			return err
+		}
+
+		delay := p.retryPolicy.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			p.logger.Debug("not retrying Porkbun API call past the deadline", "operation", operation, "error", err)
+			return err
+		}
+
+		p.logger.Debug("retrying Porkbun API call", "operation", operation, "attempt", attempt+1, "delay", delay, "reason", reason, "error", err)
+		apiRetries.WithLabelValues(operation, reason).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
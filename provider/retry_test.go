@@ -0,0 +1,136 @@
+package porkbun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	pb "github.com/nrdcg/porkbun"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryReason(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "too many requests", err: &pb.ServerError{StatusCode: 429}, want: retryReasonRateLimited},
+		{name: "service unavailable", err: &pb.ServerError{StatusCode: 503}, want: retryReasonRateLimited},
+		{name: "internal server error", err: &pb.ServerError{StatusCode: 500}, want: retryReasonServerError},
+		{name: "bad gateway", err: &pb.ServerError{StatusCode: 502}, want: retryReasonServerError},
+		{name: "gateway timeout", err: fmt.Errorf("unable to create record: %w", &pb.ServerError{StatusCode: 504}), want: retryReasonServerError},
+		{name: "bad request", err: &pb.ServerError{StatusCode: 400}, want: ""},
+		{name: "not found", err: &pb.ServerError{StatusCode: 404}, want: ""},
+		{name: "rate limit message", err: pb.Status{Status: "ERROR", Message: "Rate limit exceeded, please try again later."}, want: retryReasonRateLimited},
+		{name: "too many message", err: fmt.Errorf("unable to delete record: %w", pb.Status{Status: "ERROR", Message: "Too many requests"}), want: retryReasonRateLimited},
+		{name: "invalid API key", err: pb.Status{Status: "ERROR", Message: "Invalid API key. (002)"}, want: ""},
+		// answers other than HTTP 200 carry the Porkbun status in the response body
+		{name: "rate limit message in a bad request", err: &pb.ServerError{StatusCode: 400, Message: `{"status":"ERROR","message":"Rate limit exceeded, please try again later."}`}, want: retryReasonRateLimited},
+		{name: "invalid API key in a bad request", err: &pb.ServerError{StatusCode: 400, Message: `{"status":"ERROR","message":"Invalid API key. (002)"}`}, want: ""},
+		{name: "bad request without a status", err: &pb.ServerError{StatusCode: 400, Message: "<html>Bad Request</html>"}, want: ""},
+		{name: "invalid record", err: pb.Status{Status: "ERROR", Message: "Invalid type."}, want: ""},
+		{name: "network", err: fmt.Errorf("failed to call API: %w", &url.Error{Op: "Post", URL: "https://api.porkbun.com", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}}), want: retryReasonNetwork},
+		{name: "canceled", err: fmt.Errorf("failed to call API: %w", &url.Error{Op: "Post", URL: "https://api.porkbun.com", Err: context.Canceled}), want: ""},
+		{name: "deadline", err: context.DeadlineExceeded, want: ""},
+		{name: "other", err: errors.New("failed to unmarshal response"), want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, retryReason(tt.err))
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := retryPolicy{maxRetries: 10, baseDelay: time.Second, maxDelay: 5 * time.Second}
+
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		for range 20 {
+			delay := policy.backoff(attempt)
+			assert.GreaterOrEqual(t, delay, want/2, "attempt %d", attempt)
+			assert.LessOrEqual(t, delay, want, "attempt %d", attempt)
+		}
+	}
+
+	assert.Zero(t, retryPolicy{}.backoff(3))
+}
+
+func TestWithRetries(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRetries(2, time.Millisecond, 2*time.Millisecond))
+	assert.NoError(t, err)
+
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRetries(-1, time.Second, time.Second))
+	assert.Error(t, err)
+	_, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRetries(3, time.Minute, time.Second))
+	assert.Error(t, err)
+
+	// failing calls returns the errors in order, then succeeds
+	failing := func(errs ...error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= len(errs) {
+				return errs[calls-1]
+			}
+			return nil
+		}, &calls
+	}
+
+	t.Run("transient", func(t *testing.T) {
+		before := testutil.ToFloat64(apiRetries.WithLabelValues("test", retryReasonRateLimited))
+		call, calls := failing(&pb.ServerError{StatusCode: 503}, &pb.ServerError{StatusCode: 429})
+		assert.NoError(t, p.withRetries(context.TODO(), "test", true, call))
+		assert.Equal(t, 3, *calls)
+		assert.Equal(t, before+2, testutil.ToFloat64(apiRetries.WithLabelValues("test", retryReasonRateLimited)))
+	})
+
+	t.Run("permanent", func(t *testing.T) {
+		call, calls := failing(pb.Status{Status: "ERROR", Message: "Invalid type."})
+		assert.Error(t, p.withRetries(context.TODO(), "test", true, call))
+		assert.Equal(t, 1, *calls)
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		before := testutil.ToFloat64(apiRetriesExhausted.WithLabelValues("test"))
+		serverErr := &pb.ServerError{StatusCode: 500}
+		call, calls := failing(serverErr, serverErr, serverErr, serverErr)
+		assert.ErrorIs(t, p.withRetries(context.TODO(), "test", true, call), serverErr)
+		assert.Equal(t, 3, *calls)
+		assert.Equal(t, before+1, testutil.ToFloat64(apiRetriesExhausted.WithLabelValues("test")))
+	})
+
+	t.Run("not idempotent", func(t *testing.T) {
+		// the record may have been created
+		call, calls := failing(&pb.ServerError{StatusCode: 500})
+		assert.Error(t, p.withRetries(context.TODO(), "test", false, call))
+		assert.Equal(t, 1, *calls)
+
+		// the call was refused
+		call, calls = failing(&pb.ServerError{StatusCode: 429}, pb.Status{Status: "ERROR", Message: "rate limit exceeded"})
+		assert.NoError(t, p.withRetries(context.TODO(), "test", false, call))
+		assert.Equal(t, 3, *calls)
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		slow, err := NewPorkbunProvider([]string{"example.com"}, "KEY", "SECRET", false, logger, WithRetries(3, time.Hour, time.Hour))
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.TODO(), time.Second)
+		defer cancel()
+		call, calls := failing(&pb.ServerError{StatusCode: 503})
+		start := time.Now()
+		assert.Error(t, slow.withRetries(ctx, "test", true, call))
+		assert.Equal(t, 1, *calls)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
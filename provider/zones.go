@@ -0,0 +1,178 @@
+package porkbun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/dnsname"
+	pb "github.com/nrdcg/porkbun"
+	"golang.org/x/net/publicsuffix"
+)
+
+// listAllPageSize is the number of domains the Porkbun domain listing returns per call.
+const listAllPageSize = 1000
+
+// WithZoneDiscovery enables listing the domains of the Porkbun account and managing
+// all of them that match the domain filter, instead of treating every domain filter
+// entry as a zone. The list is fetched on first use and refreshed once it is older
+// than refreshInterval.
+func WithZoneDiscovery(enabled bool, refreshInterval time.Duration) Option {
+	return func(p *PorkbunProvider) {
+		p.zoneDiscovery = enabled
+		p.zoneRefreshInterval = refreshInterval
+	}
+}
+
+// zones returns the zones the provider manages. With zone discovery the domains of
+// the account are listed again once the last listing is older than the refresh
+// interval. If listing fails, the previously discovered zones are kept.
+func (p *PorkbunProvider) zones(ctx context.Context) ([]string, error) {
+	if !p.zoneDiscovery || p.dryRun {
+		return registeredZones(p.domainFilter.Filters), nil
+	}
+
+	p.zonesMu.Lock()
+	defer p.zonesMu.Unlock()
+
+	if p.zonesRefreshedAt.IsZero() || time.Since(p.zonesRefreshedAt) >= p.zoneRefreshInterval {
+		domains, err := p.listZones(ctx)
+		if err != nil {
+			if p.zonesRefreshedAt.IsZero() {
+				return nil, fmt.Errorf("unable to discover zones: %w", err)
+			}
+			p.logger.Warn("unable to refresh zones, using previously discovered zones", "error", err)
+			return p.discoveredZones, nil
+		}
+
+		zones := make([]string, 0, len(domains))
+		for _, domain := range domains {
+			// A domain is managed if it matches the domain filter itself or if one of
+			// the filters is a subdomain of it.
+			if p.domainFilter.IsConfigured() && !p.domainFilter.Match(domain) && !p.domainFilter.MatchParent(domain) {
+				p.logger.Debug("ignoring domain not matching the domain filter", "domain", domain)
+				continue
+			}
+			zones = append(zones, domain)
+		}
+		p.logger.Info("discovered zones", "zones", zones)
+
+		p.discoveredZones = zones
+		p.zonesRefreshedAt = time.Now()
+	}
+
+	return p.discoveredZones, nil
+}
+
+// DiscoverZones lists the domains of the Porkbun account if zone discovery is enabled,
+// so that bad credentials or a failing listing are reported at startup instead of on
+// the first sync. Later calls refresh the zones once the refresh interval passed.
+func (p *PorkbunProvider) DiscoverZones(ctx context.Context) error {
+	_, err := p.zones(ctx)
+	return err
+}
+
+// knownZones returns the zones the provider manages without refreshing discovered zones.
+func (p *PorkbunProvider) knownZones() []string {
+	if !p.zoneDiscovery || p.dryRun {
+		return registeredZones(p.domainFilter.Filters)
+	}
+
+	p.zonesMu.Lock()
+	defer p.zonesMu.Unlock()
+	return p.discoveredZones
+}
+
+// registeredZones maps domain filters onto the registered domains they belong to,
+// which are the zones Porkbun knows. A filter for "k8s.example.com" is managed in
+// the zone "example.com".
+func registeredZones(filters []string) []string {
+	zones := make([]string, 0, len(filters))
+	seen := make(map[string]bool)
+	for _, filter := range filters {
+		zone := dnsname.Normalize(strings.TrimPrefix(filter, "."))
+		if registered, err := publicsuffix.EffectiveTLDPlusOne(zone); err == nil {
+			zone = registered
+		}
+		if zone == "" || seen[zone] {
+			continue
+		}
+		seen[zone] = true
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+type listAllRequest struct {
+	APIKey        string `json:"apikey"`
+	SecretAPIKey  string `json:"secretapikey"`
+	Start         string `json:"start"`
+	IncludeLabels string `json:"includeLabels"`
+}
+
+type listAllResponse struct {
+	pb.Status
+	Domains []struct {
+		Domain string `json:"domain"`
+	} `json:"domains"`
+}
+
+// listDomains lists all domains of the Porkbun account. The porkbun client does not
+// cover the domain API, so the request is sent with the client's base URL and HTTP
+// client, and errors are reported with the client's error types.
+func listDomains(ctx context.Context, client *pb.Client, apiKey string, apiSecret string) ([]string, error) {
+	endpoint := client.BaseURL.JoinPath("domain", "listAll")
+
+	domains := make([]string, 0)
+	for start := 0; ; start += listAllPageSize {
+		reqBody, err := json.Marshal(listAllRequest{
+			APIKey:        apiKey,
+			SecretAPIKey:  apiSecret,
+			Start:         fmt.Sprint(start),
+			IncludeLabels: "no",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.String(), bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+
+		resp, err := client.HTTPClient.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to call API: %w", err)
+		}
+		respBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response body: %w", err)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, &pb.ServerError{StatusCode: resp.StatusCode, Message: string(respBody)}
+		}
+
+		listResp := listAllResponse{}
+		err = json.Unmarshal(respBody, &listResp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		if listResp.Status.Status != "SUCCESS" {
+			return nil, listResp.Status
+		}
+
+		for _, d := range listResp.Domains {
+			domains = append(domains, d.Domain)
+		}
+		if len(listResp.Domains) < listAllPageSize {
+			return domains, nil
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package porkbun
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/konnektr-io/external-dns-porkbun-webhook/provider/porkbuntest"
+	pb "github.com/nrdcg/porkbun"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneDiscovery(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// zone discovery does not require a domain filter
+	_, err := NewPorkbunProvider(nil, "KEY", "PASSWORD", false, logger)
+	assert.Error(t, err)
+	p, err := NewPorkbunProvider(nil, "KEY", "PASSWORD", false, logger, WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+
+	calls := 0
+	domains := []string{"example.com", "example.org"}
+	var listErr error
+	p.listDomains = func(ctx context.Context) ([]string, error) {
+		calls++
+		return domains, listErr
+	}
+
+	zones, err := p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, zones)
+	assert.Equal(t, []string{"example.com", "example.org"}, p.knownZones())
+
+	// cached until the refresh interval passed
+	domains = []string{"example.com", "example.org", "example.net"}
+	zones, err = p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, zones)
+	assert.Equal(t, 1, calls)
+
+	// new domains are picked up after the refresh interval
+	p.zonesRefreshedAt = time.Now().Add(-2 * time.Hour)
+	zones, err = p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org", "example.net"}, zones)
+	assert.Equal(t, 2, calls)
+
+	// failing refreshes keep the previously discovered zones
+	p.zonesRefreshedAt = time.Now().Add(-2 * time.Hour)
+	listErr = errors.New("unavailable")
+	zones, err = p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org", "example.net"}, zones)
+
+	// but the first listing has to succeed
+	p.zonesRefreshedAt = time.Time{}
+	_, err = p.zones(context.TODO())
+	assert.Error(t, err)
+}
+
+func TestDiscoverZones(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server := porkbuntest.NewServer("KEY", "SECRET")
+	defer server.Close()
+	server.AddDomain("example.com")
+	server.AddDomain("example.org")
+
+	// bad credentials are reported before the first sync
+	p, err := NewPorkbunProvider(nil, "KEY", "WRONG", false, logger,
+		WithBaseURL(server.URL), WithZoneDiscovery(true, time.Hour), WithRetries(0, 0, 0))
+	assert.NoError(t, err)
+	assert.ErrorContains(t, p.DiscoverZones(context.TODO()), "unable to discover zones")
+
+	start := len(server.Requests())
+	p, err = NewPorkbunProvider(nil, "KEY", "SECRET", false, logger,
+		WithBaseURL(server.URL), WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+	assert.NoError(t, p.DiscoverZones(context.TODO()))
+	assert.Equal(t, []string{"example.com", "example.org"}, p.knownZones())
+
+	// the first sync uses the discovered zones
+	_, err = p.Records(context.TODO())
+	assert.NoError(t, err)
+	listings := 0
+	for _, r := range server.Requests()[start:] {
+		if r.Operation == porkbuntest.OperationListAll {
+			listings++
+		}
+	}
+	assert.Equal(t, 1, listings)
+
+	// without zone discovery nothing is listed
+	p, err = NewPorkbunProvider([]string{"example.com"}, "KEY", "WRONG", false, logger, WithBaseURL(server.URL))
+	assert.NoError(t, err)
+	assert.NoError(t, p.DiscoverZones(context.TODO()))
+}
+
+func TestZoneDiscoveryDomainFilter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"example.com", "example.org"}, "KEY", "PASSWORD", false, logger, WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+	p.listDomains = func(ctx context.Context) ([]string, error) {
+		return []string{"example.com", "example.net", "notexample.com"}, nil
+	}
+
+	zones, err := p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, zones)
+
+	// without zone discovery the domain filter defines the zones
+	p, err = NewPorkbunProvider([]string{"example.com", "example.org"}, "KEY", "PASSWORD", false, logger)
+	assert.NoError(t, err)
+	zones, err = p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.org"}, zones)
+}
+
+func TestListDomains(t *testing.T) {
+	total := listAllPageSize + 2
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/domain/listAll" {
+			http.NotFound(w, r)
+			return
+		}
+		var req listAllRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.APIKey != "KEY" || req.SecretAPIKey != "SECRET" {
+			_, _ = w.Write([]byte(`{"status":"ERROR","message":"Invalid API key."}`))
+			return
+		}
+
+		var start int
+		_, _ = fmt.Sscan(req.Start, &start)
+		resp := listAllResponse{Status: pb.Status{Status: "SUCCESS"}}
+		for i := start; i < total && i < start+listAllPageSize; i++ {
+			resp.Domains = append(resp.Domains, struct {
+				Domain string `json:"domain"`
+			}{Domain: fmt.Sprintf("example%d.com", i)})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := pb.New("SECRET", "KEY")
+	client.BaseURL, _ = url.Parse(server.URL)
+
+	domains, err := listDomains(context.TODO(), client, "KEY", "SECRET")
+	assert.NoError(t, err)
+	assert.Len(t, domains, total)
+	assert.Equal(t, "example0.com", domains[0])
+	assert.Equal(t, fmt.Sprintf("example%d.com", total-1), domains[total-1])
+
+	_, err = listDomains(context.TODO(), client, "KEY", "WRONG")
+	assert.EqualError(t, err, "ERROR: Invalid API key.")
+
+	client.BaseURL = client.BaseURL.JoinPath("missing")
+	_, err = listDomains(context.TODO(), client, "KEY", "SECRET")
+	var serverErr *pb.ServerError
+	assert.ErrorAs(t, err, &serverErr)
+	assert.Equal(t, http.StatusNotFound, serverErr.StatusCode)
+}
+
+func TestRegisteredZones(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		want    []string
+	}{
+		{name: "registered domains", filters: []string{"example.com", "example.org"}, want: []string{"example.com", "example.org"}},
+		{name: "subdomain", filters: []string{"k8s.example.com"}, want: []string{"example.com"}},
+		{name: "nested subdomain", filters: []string{"a.b.example.com"}, want: []string{"example.com"}},
+		{name: "subdomains only filter", filters: []string{".k8s.example.com"}, want: []string{"example.com"}},
+		{name: "multi-label public suffix", filters: []string{"k8s.example.co.uk"}, want: []string{"example.co.uk"}},
+		{name: "deduplicated", filters: []string{"example.com", "k8s.example.com", "K8S.Example.com."}, want: []string{"example.com"}},
+		{name: "public suffix only", filters: []string{"com"}, want: []string{"com"}},
+		{name: "none", filters: nil, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, registeredZones(tt.filters))
+		})
+	}
+}
+
+func TestSubdomainFilterZones(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider([]string{"k8s.example.com"}, "KEY", "PASSWORD", false, logger)
+	assert.NoError(t, err)
+	zones, err := p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, zones)
+	assert.True(t, p.domainFilter.Match("www.k8s.example.com"))
+	assert.False(t, p.domainFilter.Match("www.example.com"))
+
+	// with zone discovery the parent zone is taken from the account
+	p, err = NewPorkbunProvider([]string{"k8s.example.com"}, "KEY", "PASSWORD", false, logger, WithZoneDiscovery(true, time.Hour))
+	assert.NoError(t, err)
+	p.listDomains = func(ctx context.Context) ([]string, error) {
+		return []string{"example.com", "example.org"}, nil
+	}
+	zones, err = p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com"}, zones)
+}
+
+func TestZoneDiscoveryExclusions(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	p, err := NewPorkbunProvider(nil, "KEY", "PASSWORD", false, logger,
+		WithZoneDiscovery(true, time.Hour), WithDomainExclusions([]string{"example.org"}))
+	assert.NoError(t, err)
+	p.listDomains = func(ctx context.Context) ([]string, error) {
+		return []string{"example.com", "example.org", "example.net"}, nil
+	}
+
+	zones, err := p.zones(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com", "example.net"}, zones)
+}